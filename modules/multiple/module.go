@@ -1,26 +1,81 @@
 package multiple
 
 import (
+	"context"
 	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/sohaha/zlsgo/zdi"
 	"github.com/sohaha/zlsgo/zerror"
+	"github.com/sohaha/zlsgo/zlog"
 	"github.com/zlsgo/app_core/service"
 )
 
 type Module struct {
 	service.App
+	modules map[string]service.Module
+	names   []string
+	order   []string
+	started []string
+	mu      sync.RWMutex
 }
 
 var (
-	_ service.Module = &Module{}
-	_                = reflect.TypeOf(&Module{})
+	_ service.Module        = &Module{}
+	_ service.ModuleDepends = &Module{}
+	_                       = reflect.TypeOf(&Module{})
 )
 
+// each calls fn for the modules of the group in initialization order until fn returns false.
+func (m *Module) each(fn func(name string, mod service.Module) bool) {
+	m.mu.RLock()
+	names := m.order
+	if names == nil {
+		names = m.names
+	}
+	mods := make([]service.Module, len(names))
+	for i := range names {
+		mods[i] = m.modules[names[i]]
+	}
+	m.mu.RUnlock()
+
+	for i := range names {
+		if !fn(names[i], mods[i]) {
+			return
+		}
+	}
+}
+
+// sort orders the modules of the group by their dependencies within the group.
+func (m *Module) sort() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deps := make(map[string][]string, len(m.names))
+	for _, name := range m.names {
+		d, ok := m.modules[name].(service.ModuleDepends)
+		if !ok {
+			continue
+		}
+		for _, dep := range d.DependsOn() {
+			if _, ok := m.modules[dep]; ok {
+				deps[name] = append(deps[name], dep)
+			}
+		}
+	}
+
+	order, err := service.Utils.SortModules(m.names, deps)
+	if err != nil {
+		return err
+	}
+	m.order = order
+	return nil
+}
+
 func (m *Module) Name() string {
 	names := make([]string, 0)
-	modules.ForEach(func(_ string, mod service.Module) bool {
+	m.each(func(_ string, mod service.Module) bool {
 		if mod.Name() == "" {
 			return true
 		}
@@ -33,9 +88,27 @@ func (m *Module) Name() string {
 	return "Multiple [" + strings.Join(names, ", ") + "]"
 }
 
+// DependsOn returns the dependencies of the modules of the group that are not part of the group.
+func (m *Module) DependsOn() []string {
+	deps := make([]string, 0)
+	m.each(func(_ string, mod service.Module) bool {
+		d, ok := mod.(service.ModuleDepends)
+		if !ok {
+			return true
+		}
+		for _, dep := range d.DependsOn() {
+			if _, ok := m.Get(dep); !ok {
+				deps = append(deps, dep)
+			}
+		}
+		return true
+	})
+	return deps
+}
+
 func (m *Module) Tasks() []service.Task {
 	tasks := make([]service.Task, 0)
-	modules.ForEach(func(_ string, mod service.Module) bool {
+	m.each(func(_ string, mod service.Module) bool {
 		tasks = append(tasks, mod.Tasks()...)
 		return true
 	})
@@ -43,7 +116,12 @@ func (m *Module) Tasks() []service.Task {
 }
 
 func (m *Module) Load(zdi.Invoker) (any, error) {
-	modules.ForEach(func(_ string, mod service.Module) bool {
+	track(m)
+	if err := m.sort(); err != nil {
+		return nil, err
+	}
+
+	m.each(func(_ string, mod service.Module) bool {
 		pdi := reflect.Indirect(reflect.ValueOf(mod)).FieldByName("DI")
 		if pdi.IsValid() {
 			pdi.Set(reflect.ValueOf(m.DI))
@@ -52,7 +130,7 @@ func (m *Module) Load(zdi.Invoker) (any, error) {
 	})
 
 	var err error
-	modules.ForEach(func(name string, mod service.Module) bool {
+	m.each(func(name string, mod service.Module) bool {
 		if err = service.Utils.LoadModule(m.DI.(zdi.Injector), name, mod); err != nil {
 			return false
 		}
@@ -61,19 +139,87 @@ func (m *Module) Load(zdi.Invoker) (any, error) {
 	return nil, err
 }
 
-func (m *Module) Start(zdi.Invoker) (err error) {
-	modules.ForEach(func(_ string, mod service.Module) bool {
+func (m *Module) Start(di zdi.Invoker) (err error) {
+	m.each(func(name string, mod service.Module) bool {
 		if e := mod.Start(m.DI); e != nil {
 			err = zerror.With(e, mod.Name()+" start error")
 			return false
 		}
+		m.mu.Lock()
+		m.started = append(m.started, name)
+		m.mu.Unlock()
 		return true
 	})
+	if err != nil {
+		// Stop resolves its context.Context like the application does when stopping the modules.
+		ctx, cancel := context.WithTimeout(context.Background(), service.Utils.StopTimeout(&m.App, m))
+		defer cancel()
+		sdi := zdi.New(stopParent(m, di))
+		_ = sdi.Map(ctx, zdi.WithInterface((*context.Context)(nil)))
+		_ = sdi.Map(sdi, zdi.WithInterface((*zdi.Invoker)(nil)))
+		if e := m.Stop(sdi); e != nil {
+			zlog.Warn(e)
+		}
+	}
 	return
 }
 
+// stopParent returns the injector the Stop of the modules resolves from.
+func stopParent(m *Module, di zdi.Invoker) zdi.Injector {
+	if inj, ok := di.(zdi.Injector); ok {
+		return inj
+	}
+	inj, _ := m.DI.(zdi.Injector)
+	return inj
+}
+
+// Stop stops the started modules of the group in reverse order,
+// every module is stopped even if another one fails. The group leaves the lookup of Get until loaded again.
+func (m *Module) Stop(di zdi.Invoker) error {
+	untrack(m)
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	var errs service.ModuleErrors
+	for i := len(started) - 1; i >= 0; i-- {
+		mod, ok := m.Get(started[i])
+		if !ok {
+			continue
+		}
+		if err := invokeMethod(di, mod, "Stop"); err != nil {
+			errs = append(errs, zerror.With(err, mod.Name()+" stop error"))
+		}
+	}
+	return errs.Err()
+}
+
+// Reload forwards the configuration reload to the modules of the group.
+func (m *Module) Reload(di zdi.Invoker) error {
+	var errs service.ModuleErrors
+	m.each(func(_ string, mod service.Module) bool {
+		if err := invokeMethod(di, mod, "Reload"); err != nil {
+			errs = append(errs, zerror.With(err, mod.Name()+" reload error"))
+		}
+		return true
+	})
+	return errs.Err()
+}
+
+// invokeMethod calls the method of the module, if it exists, resolving its arguments from di.
+func invokeMethod(di zdi.Invoker, mod service.Module, method string) error {
+	fn := reflect.ValueOf(mod).MethodByName(method)
+	if !fn.IsValid() {
+		return nil
+	}
+	return zerror.TryCatch(func() error {
+		return di.InvokeWithErrorOnly(fn.Interface())
+	})
+}
+
 func (m *Module) Done(zdi.Invoker) (err error) {
-	modules.ForEach(func(_ string, mod service.Module) bool {
+	m.each(func(_ string, mod service.Module) bool {
 		if e := mod.Done(m.DI); e != nil {
 			err = zerror.With(e, mod.Name()+" done error")
 			return false
@@ -85,7 +231,7 @@ func (m *Module) Done(zdi.Invoker) (err error) {
 
 func (m *Module) Controller() []service.Controller {
 	controllers := make([]service.Controller, 0)
-	modules.ForEach(func(_ string, mod service.Module) bool {
+	m.each(func(_ string, mod service.Module) bool {
 		controllers = append(controllers, mod.Controller()...)
 		return true
 	})
@@ -1,31 +1,106 @@
 package multiple
 
 import (
-	"github.com/sohaha/zlsgo/zarray"
+	"sort"
+	"strconv"
+	"sync"
+
 	"github.com/sohaha/zlsgo/zlog"
 	"github.com/zlsgo/app_core/service"
 )
 
-var modules = zarray.NewHashMap[string, service.Module]()
+var (
+	// groups are the live groups in creation order, a group leaves them once stopped.
+	groups   []*Module
+	groupsMu sync.RWMutex
+)
 
+// Get looks up a module by name in the live groups, the groups created by New and not stopped.
+// A name found in several groups is ambiguous, it is logged and the module of the latest group is returned.
+//
+// Deprecated: groups are independent, use (*Module).Get instead.
 func Get(name string) (service.Module, bool) {
-	return modules.Get(name)
+	groupsMu.RLock()
+	live := make([]*Module, len(groups))
+	copy(live, groups)
+	groupsMu.RUnlock()
+
+	var (
+		found service.Module
+		n     int
+	)
+	for _, g := range live {
+		if mod, ok := g.Get(name); ok {
+			found = mod
+			n++
+		}
+	}
+	if n > 1 {
+		zlog.Warn("multiple.Get found " + name + " in " + strconv.Itoa(n) + " groups, use (*Module).Get")
+	}
+	return found, n > 0
+}
+
+// track adds the group to the live groups.
+func track(m *Module) {
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+	for _, g := range groups {
+		if g == m {
+			return
+		}
+	}
+	groups = append(groups, m)
+}
+
+// untrack removes the group from the live groups.
+func untrack(m *Module) {
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+	for i, g := range groups {
+		if g == m {
+			groups = append(groups[:i], groups[i+1:]...)
+			return
+		}
+	}
 }
 
+// New creates a group owning the given modules, they are initialized in
+// dependency order and otherwise in alphabetical order of their names.
 func New(mods map[string]service.Module) *Module {
-	if modules.Len() > 0 {
-		zlog.Warn("modules already exists, please check if there are duplicate names")
+	m := &Module{modules: make(map[string]service.Module, len(mods))}
+	names := make([]string, 0, len(mods))
+	for name := range mods {
+		names = append(names, name)
 	}
-	for name, m := range mods {
-		modules.Set(name, m)
+	sort.Strings(names)
+	for _, name := range names {
+		m.Add(name, mods[name])
 	}
-	return &Module{}
+
+	track(m)
+	return m
 }
 
+// Add adds a module to the group, modules keep their insertion order
+// unless dependencies require otherwise.
 func (m *Module) Add(name string, plugin service.Module) {
-	modules.Set(name, plugin)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.modules == nil {
+		m.modules = make(map[string]service.Module)
+	}
+	if _, ok := m.modules[name]; !ok {
+		m.names = append(m.names, name)
+	}
+	m.modules[name] = plugin
+	m.order = nil
 }
 
+// Get returns the module of the group with the given name.
 func (m *Module) Get(name string) (service.Module, bool) {
-	return Get(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mod, ok := m.modules[name]
+	return mod, ok
 }
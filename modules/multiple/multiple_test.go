@@ -0,0 +1,113 @@
+package multiple
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/zlsgo/app_core/service"
+)
+
+type testModule struct {
+	service.ModuleLifeCycle
+	name string
+}
+
+func (m *testModule) Name() string {
+	return m.name
+}
+
+func TestGetSearchesLiveGroups(t *testing.T) {
+	a, b := &testModule{name: "a"}, &testModule{name: "b"}
+	ga := New(map[string]service.Module{"a": a})
+	gb := New(map[string]service.Module{"b": b})
+	defer func() {
+		_ = gb.Stop(zdi.New())
+	}()
+
+	if mod, ok := Get("a"); !ok || mod != a {
+		t.Fatal("expected a from the first group")
+	}
+	if mod, ok := Get("b"); !ok || mod != b {
+		t.Fatal("expected b from the second group")
+	}
+
+	a2 := &testModule{name: "a"}
+	g := New(map[string]service.Module{"a": a2})
+	if mod, ok := Get("a"); !ok || mod != a2 {
+		t.Fatal("expected an ambiguous name to resolve to the latest group")
+	}
+
+	_ = g.Stop(zdi.New())
+	_ = ga.Stop(zdi.New())
+	if _, ok := Get("a"); ok {
+		t.Fatal("expected the stopped groups to leave the lookup")
+	}
+	if mod, ok := Get("b"); !ok || mod != b {
+		t.Fatal("expected b from the live group")
+	}
+}
+
+type testCtxModule struct {
+	testModule
+	stopped bool
+}
+
+func (m *testCtxModule) Stop(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); ok {
+		m.stopped = true
+	}
+	return nil
+}
+
+func TestStartRollbackStopsWithContext(t *testing.T) {
+	a := &testCtxModule{testModule: testModule{name: "a"}}
+	b := &testModule{name: "b", ModuleLifeCycle: service.ModuleLifeCycle{
+		OnStart: func(zdi.Invoker) error { return errors.New("failed") },
+	}}
+	g := New(map[string]service.Module{"a": a, "b": b})
+	g.DI = zdi.New()
+	if _, err := g.Load(zdi.New()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(zdi.New()); err == nil {
+		t.Fatal("expected the start failure")
+	}
+	if !a.stopped {
+		t.Fatal("expected a to be stopped with a deadline context")
+	}
+}
+
+type testValue struct{}
+
+type testLoadModule struct {
+	testModule
+}
+
+func (m *testLoadModule) Load(zdi.Invoker) (any, error) {
+	return &testValue{}, nil
+}
+
+func TestUnregisterReleasesChildProviders(t *testing.T) {
+	di := zdi.New()
+	_ = di.Map(&service.Conf{Base: service.BaseConf{StrictDI: true}})
+	app := service.NewApp(func(o service.BaseConf) service.BaseConf {
+		o.DisableDebug = true
+		return o
+	})(di)
+
+	g := New(map[string]service.Module{"child": &testLoadModule{testModule{name: "child"}}})
+	if err := app.RegisterModule(g); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.UnregisterModule(g.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RegisterModule(&testLoadModule{testModule{name: "other"}}); err != nil {
+		t.Fatal(err)
+	}
+	if owner := app.Providers()["*multiple.testValue"]; owner != "other" {
+		t.Fatalf("expected the value provided by other, got %q", owner)
+	}
+}
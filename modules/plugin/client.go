@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/sohaha/zlsgo/zlog"
+)
+
+// errExited is returned by calls made while or after the plugin process exits.
+var errExited = errors.New("plugin process exited")
+
+// client runs the plugin process and exchanges requests and responses over its stdio.
+type client struct {
+	stdin   io.WriteCloser
+	wait    func() error // wait waits for the process to exit once its stdout is closed.
+	kill    func() error // kill kills the process.
+	pending map[uint64]chan Response
+	done    chan struct{}
+	exitErr error
+	seq     uint64
+	mu      sync.Mutex
+	wmu     sync.Mutex
+}
+
+// startClient launches the plugin executable.
+func startClient(o Options, log *zlog.Logger) (*client, error) {
+	cmd := exec.Command(o.Command, o.Args...)
+	cmd.Dir = o.Dir
+	cmd.Env = append(os.Environ(), o.Env...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		s := bufio.NewScanner(stderr)
+		for s.Scan() {
+			log.Warn(s.Text())
+		}
+		_, _ = io.Copy(io.Discard, stderr)
+	}()
+
+	// Wait closes stderr, its last lines, usually the reason of a crash, are logged before.
+	wait := func() error {
+		<-logged
+		return cmd.Wait()
+	}
+	return newClient(stdin, stdout, wait, cmd.Process.Kill, log), nil
+}
+
+// newClient exchanges requests and responses with a started plugin over its stdin and stdout.
+func newClient(stdin io.WriteCloser, stdout io.Reader, wait, kill func() error, log *zlog.Logger) *client {
+	c := &client{
+		stdin:   stdin,
+		wait:    wait,
+		kill:    kill,
+		pending: make(map[uint64]chan Response),
+		done:    make(chan struct{}),
+	}
+	go c.read(stdout, log)
+	return c
+}
+
+// read dispatches the responses of the plugin until its stdout is closed,
+// the process is killed when it breaks the protocol.
+func (c *client) read(stdout io.Reader, log *zlog.Logger) {
+	var protoErr error
+	dec := json.NewDecoder(stdout)
+	for {
+		var res Response
+		if err := dec.Decode(&res); err != nil {
+			if err != io.EOF {
+				protoErr = errors.New("invalid plugin response: " + err.Error())
+				log.Error(protoErr.Error())
+				_ = c.kill()
+			}
+			break
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[res.ID]
+		delete(c.pending, res.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- res
+		}
+	}
+
+	err := c.wait()
+
+	c.mu.Lock()
+	c.exitErr = err
+	if protoErr != nil {
+		c.exitErr = protoErr
+	}
+	if c.exitErr == nil {
+		c.exitErr = errExited
+	}
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	close(c.done)
+	c.mu.Unlock()
+}
+
+// call sends the request and waits for its response, result may be nil.
+func (c *client) call(ctx context.Context, method string, params, result interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan Response, 1)
+	c.mu.Lock()
+	if c.exited() {
+		c.mu.Unlock()
+		return errExited
+	}
+	c.seq++
+	id := c.seq
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	b, err := json.Marshal(Request{ID: id, Method: method, Params: raw})
+	if err == nil {
+		c.wmu.Lock()
+		_, err = c.stdin.Write(append(b, '\n'))
+		c.wmu.Unlock()
+	}
+	if err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return errExited
+		}
+		if res.Error != "" {
+			return errors.New(res.Error)
+		}
+		if result != nil && len(res.Result) > 0 {
+			return json.Unmarshal(res.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	}
+}
+
+func (c *client) forget(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// exited reports whether the process has exited, c.mu must be held.
+func (c *client) exited() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close asks the plugin to stop, then closes its stdin and kills it
+// if it is still running when ctx is done.
+func (c *client) close(ctx context.Context) error {
+	err := c.call(ctx, MethodStop, nil, nil)
+	_ = c.stdin.Close()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		_ = c.kill()
+		<-c.done
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	if errors.Is(err, errExited) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,329 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/zerror"
+	"github.com/sohaha/zlsgo/zlog"
+	"github.com/sohaha/zlsgo/znet"
+	"github.com/sohaha/zlsgo/ztype"
+	"github.com/sohaha/zlsgo/zutil"
+	"github.com/zlsgo/app_core/service"
+)
+
+type Module struct {
+	service.App
+	client   *client
+	stopping *zutil.Bool                                        // stopping is the stop flag of the current run, each Start has its own.
+	start    func(o Options, log *zlog.Logger) (*client, error) // start launches the plugin process.
+	opt      Options
+	manifest Manifest
+	mu       sync.RWMutex
+}
+
+var (
+	_ service.Module       = &Module{}
+	_ service.ModuleHealth = &Module{}
+)
+
+func (m *Module) Name() string {
+	if m.opt.Name != "" {
+		return "Plugin(" + m.opt.Name + ")"
+	}
+	return "Plugin"
+}
+
+func (m *Module) Load(zdi.Invoker) (any, error) {
+	if m.opt.Command == "" {
+		return nil, errors.New("plugin command is required")
+	}
+	return nil, nil
+}
+
+// Start launches the plugin and runs the handshake and start calls.
+func (m *Module) Start(zdi.Invoker) error {
+	stopping := zutil.NewBool(false)
+	m.mu.Lock()
+	m.stopping = stopping
+	m.mu.Unlock()
+
+	c, err := m.launch()
+	if err != nil {
+		return err
+	}
+	go m.watch(c, stopping)
+	return nil
+}
+
+func (m *Module) Done(zdi.Invoker) error {
+	return nil
+}
+
+// Tasks returns the timed tasks declared by the plugin, they run inside the plugin.
+func (m *Module) Tasks() []service.Task {
+	manifest := m.Manifest()
+	tasks := make([]service.Task, 0, len(manifest.Tasks))
+	for i := range manifest.Tasks {
+		spec := manifest.Tasks[i]
+		tasks = append(tasks, service.Task{
+			Name: m.opt.Name + ":" + spec.Name,
+			Cron: spec.Cron,
+			Run: func() {
+				if err := m.call(context.Background(), MethodTask, Task{Name: spec.Name}, nil); err != nil {
+					m.Log.Error("task " + spec.Name + ": " + err.Error())
+				}
+			},
+		})
+	}
+	return tasks
+}
+
+// Controller returns the controller proxying the routes declared by the plugin.
+func (m *Module) Controller() []service.Controller {
+	return []service.Controller{&controller{Path: m.opt.Prefix, m: m}}
+}
+
+// Reload passes the new config section to the plugin.
+func (m *Module) Reload(conf *service.Conf) error {
+	return m.call(context.Background(), MethodReload, Reload{Config: m.config(conf)}, nil)
+}
+
+// Health reports whether the plugin process answers.
+func (m *Module) Health(ctx context.Context) error {
+	return m.call(ctx, MethodPing, nil, nil)
+}
+
+// Stop asks the plugin to stop and waits for its process to exit until ctx is done.
+func (m *Module) Stop(ctx context.Context) error {
+	m.mu.RLock()
+	c, stopping := m.client, m.stopping
+	m.mu.RUnlock()
+	if stopping != nil {
+		stopping.Store(true)
+	}
+	if c == nil {
+		return nil
+	}
+	return c.close(ctx)
+}
+
+func (m *Module) config(conf *service.Conf) map[string]interface{} {
+	if conf == nil {
+		return map[string]interface{}{}
+	}
+	var section ztype.Map
+	_ = conf.Unmarshal(m.opt.ConfKey, &section)
+	if section == nil {
+		section = ztype.Map{}
+	}
+	return section
+}
+
+// launch starts the plugin process and runs the handshake and start calls.
+func (m *Module) launch() (*client, error) {
+	config := m.config(m.Conf)
+	c, err := m.start(m.opt, m.Log)
+	if err != nil {
+		return nil, zerror.With(err, "failed to launch plugin")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.opt.Timeout)
+	defer cancel()
+
+	var manifest Manifest
+	err = c.call(ctx, MethodHandshake, Handshake{Version: ProtocolVersion, Config: config}, &manifest)
+	if err == nil && manifest.Version != ProtocolVersion {
+		err = errors.New("unsupported protocol version " + strconv.Itoa(manifest.Version) + ", expected " + strconv.Itoa(ProtocolVersion))
+	}
+	if err == nil {
+		err = checkRoutes(manifest.Routes)
+	}
+	if err == nil {
+		err = c.call(ctx, MethodStart, nil, nil)
+	}
+	if err != nil {
+		_ = c.close(ctx)
+		return nil, zerror.With(err, "plugin handshake failed")
+	}
+
+	m.mu.Lock()
+	if m.client != nil && !sameRoutes(m.manifest, manifest) {
+		m.Log.Warn("plugin routes changed after restart, they are applied on the next application start")
+	}
+	m.client = c
+	m.manifest = manifest
+	m.mu.Unlock()
+
+	return c, nil
+}
+
+// watch restarts the plugin when its process exits unexpectedly,
+// until stopping, the stop flag of the run it watches, is set.
+// The restarts older than RestartWindow no longer count towards MaxRestarts.
+func (m *Module) watch(c *client, stopping *zutil.Bool) {
+	var restarts []time.Time
+	for {
+		<-c.done
+		if stopping.Load() {
+			return
+		}
+
+		m.Log.Error("plugin crashed: " + c.exitErr.Error())
+		for {
+			recent := restarts[:0]
+			for _, t := range restarts {
+				if time.Since(t) < m.opt.RestartWindow {
+					recent = append(recent, t)
+				}
+			}
+			restarts = recent
+			if m.opt.MaxRestarts < 0 || len(restarts) >= m.opt.MaxRestarts {
+				m.Log.Error("plugin is not restarted, restart limit reached")
+				return
+			}
+			restarts = append(restarts, time.Now())
+			time.Sleep(m.opt.RestartDelay)
+			if stopping.Load() {
+				return
+			}
+
+			nc, err := m.launch()
+			if err != nil {
+				m.Log.Error(strings.Join(zerror.UnwrapErrors(err), ": "))
+				continue
+			}
+			if stopping.Load() {
+				ctx, cancel := context.WithTimeout(context.Background(), m.opt.Timeout)
+				_ = nc.close(ctx)
+				cancel()
+				return
+			}
+			m.Log.Warn("plugin restarted")
+			c = nc
+			break
+		}
+	}
+}
+
+func (m *Module) call(ctx context.Context, method string, params, result interface{}) error {
+	m.mu.RLock()
+	c := m.client
+	m.mu.RUnlock()
+	if c == nil {
+		return errExited
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.opt.Timeout)
+	defer cancel()
+	return c.call(ctx, method, params, result)
+}
+
+// routeMethods are the HTTP methods a plugin route can be declared with, ANY matches every method.
+var routeMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodDelete:  {},
+	http.MethodPatch:   {},
+	http.MethodHead:    {},
+	http.MethodOptions: {},
+	"ANY":              {},
+}
+
+// checkRoutes refuses the routes the router can not bind.
+func checkRoutes(routes []Route) error {
+	for _, route := range routes {
+		if _, ok := routeMethods[strings.ToUpper(route.Method)]; !ok {
+			return errors.New("route " + route.Path + ": unsupported method " + strconv.Quote(route.Method))
+		}
+		if route.Path == "" {
+			return errors.New("route with method " + route.Method + ": path is required")
+		}
+	}
+	return nil
+}
+
+func sameRoutes(a, b Manifest) bool {
+	return reflect.DeepEqual(a.Routes, b.Routes)
+}
+
+// errBodyTooLarge is answered to the requests with a body over MaxBodySize.
+var errBodyTooLarge = errors.New("request body too large")
+
+// controller mounts the plugin routes and proxies their requests to the plugin.
+type controller struct {
+	m    *Module
+	Path string
+}
+
+func (p *controller) Init(r *znet.Engine) error {
+	routes := p.m.Manifest().Routes
+	if err := checkRoutes(routes); err != nil {
+		return err
+	}
+	for _, route := range routes {
+		r.Handle(strings.ToUpper(route.Method), route.Path, p.proxy)
+	}
+	return nil
+}
+
+func (p *controller) proxy(c *znet.Context) {
+	var (
+		body []byte
+		err  error
+	)
+	if c.Request.Body != nil {
+		limit := p.m.opt.MaxBodySize
+		if limit > 0 && c.Request.ContentLength > limit {
+			c.String(http.StatusRequestEntityTooLarge, "%s", errBodyTooLarge.Error())
+			return
+		}
+		r := c.Request.Body
+		if limit > 0 {
+			r = http.MaxBytesReader(c.Writer, r, limit)
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			// The body reaches the limit before the reader fails on the byte over it.
+			if limit > 0 && int64(len(body)) >= limit {
+				c.String(http.StatusRequestEntityTooLarge, "%s", errBodyTooLarge.Error())
+				return
+			}
+			c.String(http.StatusBadRequest, "%s", err.Error())
+			return
+		}
+	}
+
+	req := HTTPRequest{
+		Method: c.Request.Method,
+		Path:   c.Request.URL.Path,
+		Query:  c.Request.URL.RawQuery,
+		Header: c.Request.Header,
+		Body:   body,
+	}
+
+	var res HTTPResponse
+	if err = p.m.call(c.Request.Context(), MethodHTTP, req, &res); err != nil {
+		c.String(http.StatusBadGateway, "%s", err.Error())
+		return
+	}
+
+	for k, values := range res.Header {
+		for i := range values {
+			c.SetHeader(k, values[i])
+		}
+	}
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	c.Byte(int32(res.Status), res.Body)
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"time"
+)
+
+type Options struct {
+	// Name is the module name, it is also the default config section and route prefix.
+	Name string
+	// Command is the plugin executable.
+	Command string
+	// Dir is the working directory of the plugin.
+	Dir string
+	// ConfKey is the config section passed to the plugin.
+	ConfKey string
+	// Prefix is the path the plugin routes are mounted under.
+	Prefix string
+	// Args are the arguments of the plugin executable.
+	Args []string
+	// Env is added to the environment of the plugin.
+	Env []string
+	// Timeout is the maximum duration of a call to the plugin.
+	Timeout time.Duration
+	// RestartDelay is the delay before restarting a crashed plugin.
+	RestartDelay time.Duration
+	// MaxRestarts is the number of times a crashed plugin is restarted within RestartWindow,
+	// 0 defaults to 3 and a negative value disables restarting.
+	MaxRestarts int
+	// RestartWindow is the period the restarts are counted in, 0 defaults to 10 minutes.
+	RestartWindow time.Duration
+	// MaxBodySize is the maximum size of a request body proxied to the plugin,
+	// 0 defaults to 10 MB and a negative value disables the limit.
+	MaxBodySize int64
+}
+
+func New(o Options) *Module {
+	if o.ConfKey == "" {
+		o.ConfKey = o.Name
+	}
+	if o.Prefix == "" {
+		o.Prefix = o.Name
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.RestartDelay <= 0 {
+		o.RestartDelay = time.Second
+	}
+	if o.MaxRestarts == 0 {
+		o.MaxRestarts = 3
+	}
+	if o.RestartWindow <= 0 {
+		o.RestartWindow = 10 * time.Minute
+	}
+	if o.MaxBodySize == 0 {
+		o.MaxBodySize = 10 << 20
+	}
+	return &Module{
+		opt:   o,
+		start: startClient,
+	}
+}
+
+// Manifest returns what the running plugin declared in the handshake.
+func (m *Module) Manifest() Manifest {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.manifest
+}
@@ -0,0 +1,414 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sohaha/zlsgo/zerror"
+	"github.com/sohaha/zlsgo/zlog"
+	"github.com/sohaha/zlsgo/znet"
+)
+
+var errKilled = errors.New("killed")
+
+func testLog() *zlog.Logger {
+	log := zlog.New()
+	log.Discard()
+	return log
+}
+
+// pipeClient connects a client to serve, run as the plugin process over pipes.
+func pipeClient(serve func(r io.Reader, w io.Writer) error) *client {
+	hostR, pluginW := io.Pipe()
+	pluginR, hostW := io.Pipe()
+	exited := make(chan error, 1)
+	go func() {
+		err := serve(pluginR, pluginW)
+		_ = pluginW.Close()
+		exited <- err
+	}()
+	wait := func() error { return <-exited }
+	kill := func() error {
+		_ = pluginR.CloseWithError(errKilled)
+		return pluginW.CloseWithError(errKilled)
+	}
+	return newClient(hostW, hostR, wait, kill, testLog())
+}
+
+// pipeLauncher launches a new run of the server for every start of the plugin.
+type pipeLauncher struct {
+	s       *Server
+	clients []*client
+	mu      sync.Mutex
+}
+
+func (l *pipeLauncher) start(Options, *zlog.Logger) (*client, error) {
+	c := pipeClient(l.s.Serve)
+	l.mu.Lock()
+	l.clients = append(l.clients, c)
+	l.mu.Unlock()
+	return c, nil
+}
+
+func (l *pipeLauncher) launched() []*client {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*client(nil), l.clients...)
+}
+
+func newTestModule(o Options, start func(Options, *zlog.Logger) (*client, error)) *Module {
+	if o.Name == "" {
+		o.Name = "test"
+	}
+	o.Command = "plugin"
+	m := New(o)
+	m.start = start
+	m.Log = testLog()
+	return m
+}
+
+func testCall(t *testing.T, c *client, method string, params, result interface{}) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.call(ctx, method, params, result)
+}
+
+func TestServeHandshake(t *testing.T) {
+	s := &Server{
+		Name:   "echo",
+		Routes: []Route{{Method: "GET", Path: "/ping"}},
+		Tasks:  []TaskSpec{{Name: "tick", Cron: "* * * * *"}},
+	}
+	c := pipeClient(s.Serve)
+
+	if err := testCall(t, c, MethodHandshake, Handshake{Version: ProtocolVersion + 1}, nil); err == nil ||
+		!strings.Contains(err.Error(), "unsupported protocol version") {
+		t.Fatalf("expected the version to be refused, got %v", err)
+	}
+
+	var manifest Manifest
+	if err := testCall(t, c, MethodHandshake, Handshake{Version: ProtocolVersion}, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != ProtocolVersion || manifest.Name != "echo" || len(manifest.Routes) != 1 || len(manifest.Tasks) != 1 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	if err := testCall(t, c, "unknown", nil, nil); err == nil || !strings.Contains(err.Error(), "unknown method") {
+		t.Fatalf("expected the unknown method to be refused, got %v", err)
+	}
+	if err := testCall(t, c, MethodPing, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := testCall(t, c, MethodPing, nil, nil); !errors.Is(err, errExited) {
+		t.Fatalf("expected calls after the stop to fail, got %v", err)
+	}
+}
+
+func TestServeConfig(t *testing.T) {
+	var started, reloaded map[string]interface{}
+	s := &Server{
+		OnStart:  func(config map[string]interface{}) error { started = config; return nil },
+		OnReload: func(config map[string]interface{}) error { reloaded = config; return nil },
+	}
+	c := pipeClient(s.Serve)
+
+	if err := testCall(t, c, MethodHandshake, Handshake{Version: ProtocolVersion, Config: map[string]interface{}{"key": "a"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := testCall(t, c, MethodStart, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := testCall(t, c, MethodReload, Reload{Config: map[string]interface{}{"key": "b"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if started["key"] != "a" || reloaded["key"] != "b" {
+		t.Fatalf("unexpected configs %v %v", started, reloaded)
+	}
+}
+
+func TestClientVersionMismatch(t *testing.T) {
+	// The plugin answers every call, the handshake with a protocol version the host does not speak.
+	fake := func(r io.Reader, w io.Writer) error {
+		dec, enc := json.NewDecoder(r), json.NewEncoder(w)
+		for {
+			var req Request
+			if err := dec.Decode(&req); err != nil {
+				return nil
+			}
+			res := Response{ID: req.ID}
+			if req.Method == MethodHandshake {
+				res.Result, _ = json.Marshal(Manifest{Version: ProtocolVersion + 1})
+			}
+			_ = enc.Encode(res)
+			if req.Method == MethodStop {
+				return nil
+			}
+		}
+	}
+
+	m := newTestModule(Options{}, func(Options, *zlog.Logger) (*client, error) {
+		return pipeClient(fake), nil
+	})
+	err := m.Start(nil)
+	if err == nil || !strings.Contains(strings.Join(zerror.UnwrapErrors(err), ": "), "unsupported protocol version") {
+		t.Fatalf("expected the protocol version to be refused, got %v", err)
+	}
+}
+
+func TestClientProtocolError(t *testing.T) {
+	c := pipeClient(func(r io.Reader, w io.Writer) error {
+		_, _ = io.WriteString(w, "not json\n")
+		_, _ = io.Copy(io.Discard, r)
+		return nil
+	})
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the plugin breaking the protocol to be killed")
+	}
+	if c.exitErr == nil || !strings.Contains(c.exitErr.Error(), "invalid plugin response") {
+		t.Fatalf("unexpected exit error %v", c.exitErr)
+	}
+	if err := testCall(t, c, MethodPing, nil, nil); !errors.Is(err, errExited) {
+		t.Fatalf("expected calls after the exit to fail, got %v", err)
+	}
+}
+
+func TestModuleRoutesAndTasks(t *testing.T) {
+	ran := make(chan string, 1)
+	l := &pipeLauncher{s: &Server{
+		Routes: []Route{{Method: "post", Path: "/echo"}},
+		Tasks:  []TaskSpec{{Name: "tick", Cron: "* * * * *"}},
+		OnHTTP: func(req HTTPRequest) HTTPResponse {
+			return HTTPResponse{
+				Status: http.StatusCreated,
+				Header: map[string][]string{"X-Plugin": {req.Method}},
+				Body:   append([]byte(req.Path+"?"+req.Query+" "), req.Body...),
+			}
+		},
+		OnTask: func(name string) error {
+			ran <- name
+			return nil
+		},
+	}}
+	m := newTestModule(Options{Name: "echo"}, l.start)
+	if err := m.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m.Stop(context.Background()) }()
+
+	r := znet.New()
+	r.SetMode(znet.ProdMode)
+	controllers := m.Controller()
+	if len(controllers) != 1 {
+		t.Fatalf("expected the proxy controller, got %d", len(controllers))
+	}
+	if err := controllers[0].Init(r); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo?a=1", strings.NewReader("body")))
+	if w.Code != http.StatusCreated || w.Body.String() != "/echo?a=1 body" || w.Header().Get("X-Plugin") != http.MethodPost {
+		t.Fatalf("unexpected response %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	tasks := m.Tasks()
+	if len(tasks) != 1 || tasks[0].Name != "echo:tick" {
+		t.Fatalf("unexpected tasks %+v", tasks)
+	}
+	tasks[0].Run()
+	select {
+	case name := <-ran:
+		if name != "tick" {
+			t.Fatalf("unexpected task %q", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the task to run in the plugin")
+	}
+}
+
+func TestModuleRestartsAfterExit(t *testing.T) {
+	l := &pipeLauncher{s: &Server{}}
+	m := newTestModule(Options{RestartDelay: time.Millisecond, MaxRestarts: 2}, l.start)
+	if err := m.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		clients := l.launched()
+		_ = clients[len(clients)-1].kill()
+		waitFor(t, func() bool { return len(l.launched()) == i+1 && m.Health(context.Background()) == nil })
+	}
+
+	// The restart limit is reached, the plugin stays down.
+	clients := l.launched()
+	c := clients[len(clients)-1]
+	_ = c.kill()
+	<-c.done
+	time.Sleep(20 * time.Millisecond)
+	if n := len(l.launched()); n != 3 {
+		t.Fatalf("expected 3 launches, got %d", n)
+	}
+	if err := m.Health(context.Background()); err == nil {
+		t.Fatal("expected the plugin to stay down")
+	}
+}
+
+func TestModuleRestartWindow(t *testing.T) {
+	l := &pipeLauncher{s: &Server{}}
+	m := newTestModule(Options{RestartDelay: time.Millisecond, MaxRestarts: 1, RestartWindow: 50 * time.Millisecond}, l.start)
+	if err := m.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	crash := func() *client {
+		clients := l.launched()
+		c := clients[len(clients)-1]
+		_ = c.kill()
+		return c
+	}
+
+	crash()
+	waitFor(t, func() bool { return len(l.launched()) == 2 && m.Health(context.Background()) == nil })
+
+	// The restart left the window, the plugin is restarted again.
+	time.Sleep(60 * time.Millisecond)
+	crash()
+	waitFor(t, func() bool { return len(l.launched()) == 3 && m.Health(context.Background()) == nil })
+
+	<-crash().done
+	time.Sleep(20 * time.Millisecond)
+	if n := len(l.launched()); n != 3 {
+		t.Fatalf("expected the restart limit within the window, got %d launches", n)
+	}
+}
+
+func TestModuleStopDoesNotRestart(t *testing.T) {
+	l := &pipeLauncher{s: &Server{}}
+	m := newTestModule(Options{RestartDelay: time.Millisecond}, l.start)
+	if err := m.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(l.launched()); n != 1 {
+		t.Fatalf("expected the stopped plugin not to restart, got %d launches", n)
+	}
+}
+
+func TestProxyBodyLimit(t *testing.T) {
+	l := &pipeLauncher{s: &Server{
+		Routes: []Route{{Method: "POST", Path: "/echo"}},
+		OnHTTP: func(req HTTPRequest) HTTPResponse { return HTTPResponse{Body: req.Body} },
+	}}
+	m := newTestModule(Options{MaxBodySize: 4}, l.start)
+	if err := m.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m.Stop(context.Background()) }()
+
+	r := znet.New()
+	r.SetMode(znet.ProdMode)
+	if err := m.Controller()[0].Init(r); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		body   string
+		length bool
+		code   int
+	}{
+		{body: "body", length: true, code: http.StatusOK},
+		{body: "bodies", length: true, code: http.StatusRequestEntityTooLarge},
+		{body: "bodies", code: http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tt.body))
+		if !tt.length {
+			// A body of unknown length is only stopped while it is read.
+			req.ContentLength = -1
+			req.Body = io.NopCloser(strings.NewReader(tt.body))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Fatalf("%q: expected %d, got %d %q", tt.body, tt.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestClientLogsStderrBeforeExit(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is required")
+	}
+	var buf bytes.Buffer
+	log := zlog.NewZLog(&buf, "", 0, zlog.LogDump, false, 3)
+	c, err := startClient(Options{Command: "sh", Args: []string{"-c", "echo last words >&2; exit 1"}}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the plugin to exit")
+	}
+	if !strings.Contains(buf.String(), "last words") {
+		t.Fatalf("expected the stderr of the plugin to be logged, got %q", buf.String())
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	for _, tt := range []struct {
+		routes []Route
+		ok     bool
+	}{
+		{routes: nil, ok: true},
+		{routes: []Route{{Method: "get", Path: "/a"}, {Method: "ANY", Path: "/b"}}, ok: true},
+		{routes: []Route{{Method: "CONNECT", Path: "/a"}}},
+		{routes: []Route{{Method: "", Path: "/a"}}},
+		{routes: []Route{{Method: "GET"}}},
+	} {
+		if err := checkRoutes(tt.routes); (err == nil) != tt.ok {
+			t.Fatalf("checkRoutes(%v) = %v", tt.routes, err)
+		}
+	}
+
+	l := &pipeLauncher{s: &Server{Routes: []Route{{Method: "TRACE", Path: "/a"}}}}
+	m := newTestModule(Options{}, l.start)
+	if err := m.Start(nil); err == nil {
+		t.Fatal("expected the unsupported route method to be refused")
+	}
+}
+
+func waitFor(t *testing.T, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"encoding/json"
+)
+
+// ProtocolVersion is the version of the stdio RPC protocol spoken with plugins,
+// a plugin answering the handshake with another version is refused.
+const ProtocolVersion = 1
+
+// Methods called by the host on the plugin.
+const (
+	MethodHandshake = "handshake"
+	MethodStart     = "start"
+	MethodHTTP      = "http"
+	MethodTask      = "task"
+	MethodReload    = "reload"
+	MethodPing      = "ping"
+	MethodStop      = "stop"
+)
+
+type (
+	// Request is a call sent by the host, one JSON document per line on the plugin stdin.
+	Request struct {
+		Params json.RawMessage `json:"params,omitempty"`
+		Method string          `json:"method"`
+		ID     uint64          `json:"id"`
+	}
+
+	// Response answers the Request with the same ID, one JSON document per line on the plugin stdout.
+	Response struct {
+		Result json.RawMessage `json:"result,omitempty"`
+		Error  string          `json:"error,omitempty"`
+		ID     uint64          `json:"id"`
+	}
+
+	// Handshake is the parameter of the handshake call.
+	Handshake struct {
+		Config  map[string]interface{} `json:"config"`
+		Version int                    `json:"version"`
+	}
+
+	// Manifest is the result of the handshake call, it declares what the plugin contributes.
+	Manifest struct {
+		Name    string     `json:"name"`
+		Routes  []Route    `json:"routes"`
+		Tasks   []TaskSpec `json:"tasks"`
+		Version int        `json:"version"`
+	}
+
+	// Route is an HTTP route proxied to the plugin.
+	Route struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+	}
+
+	// TaskSpec is a timed task run by the plugin.
+	TaskSpec struct {
+		Name string `json:"name"`
+		Cron string `json:"cron"`
+	}
+
+	// Reload is the parameter of the reload call.
+	Reload struct {
+		Config map[string]interface{} `json:"config"`
+	}
+
+	// Task is the parameter of the task call.
+	Task struct {
+		Name string `json:"name"`
+	}
+
+	// HTTPRequest is the parameter of the http call.
+	HTTPRequest struct {
+		Header map[string][]string `json:"header"`
+		Method string              `json:"method"`
+		Path   string              `json:"path"`
+		Query  string              `json:"query"`
+		Body   []byte              `json:"body"`
+	}
+
+	// HTTPResponse is the result of the http call.
+	HTTPResponse struct {
+		Header map[string][]string `json:"header"`
+		Body   []byte              `json:"body"`
+		Status int                 `json:"status"`
+	}
+)
@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Server is the plugin side of the protocol, plugin executables written in Go
+// describe what they contribute and call Serve.
+type Server struct {
+	OnStart  func(config map[string]interface{}) error
+	OnHTTP   func(req HTTPRequest) HTTPResponse
+	OnTask   func(name string) error
+	OnReload func(config map[string]interface{}) error
+	OnStop   func() error
+	Name     string
+	Routes   []Route
+	Tasks    []TaskSpec
+}
+
+// Serve answers the host on the standard input and output until the host stops the plugin.
+func Serve(s *Server) error {
+	return s.Serve(os.Stdin, os.Stdout)
+}
+
+// Serve answers the requests read from r on w until the stop request or the end of r.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	var (
+		wmu    sync.Mutex
+		wg     sync.WaitGroup
+		config map[string]interface{}
+		enc    = json.NewEncoder(w)
+		dec    = json.NewDecoder(r)
+	)
+
+	reply := func(id uint64, result interface{}, err error) {
+		res := Response{ID: id}
+		if err != nil {
+			res.Error = err.Error()
+		} else if result != nil {
+			res.Result, err = json.Marshal(result)
+			if err != nil {
+				res.Error = err.Error()
+			}
+		}
+		wmu.Lock()
+		_ = enc.Encode(res)
+		wmu.Unlock()
+	}
+
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			wg.Wait()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch req.Method {
+		case MethodHandshake:
+			var h Handshake
+			if err := json.Unmarshal(req.Params, &h); err != nil {
+				reply(req.ID, nil, err)
+				continue
+			}
+			if h.Version != ProtocolVersion {
+				reply(req.ID, nil, errors.New("unsupported protocol version "+strconv.Itoa(h.Version)))
+				continue
+			}
+			config = h.Config
+			reply(req.ID, Manifest{Version: ProtocolVersion, Name: s.Name, Routes: s.Routes, Tasks: s.Tasks}, nil)
+		case MethodStart:
+			var err error
+			if s.OnStart != nil {
+				err = s.OnStart(config)
+			}
+			reply(req.ID, nil, err)
+		case MethodPing:
+			reply(req.ID, nil, nil)
+		case MethodReload:
+			var p Reload
+			err := json.Unmarshal(req.Params, &p)
+			if err == nil && s.OnReload != nil {
+				err = s.OnReload(p.Config)
+			}
+			reply(req.ID, nil, err)
+		case MethodHTTP, MethodTask:
+			wg.Add(1)
+			go func(req Request) {
+				defer wg.Done()
+				s.handle(req, reply)
+			}(req)
+		case MethodStop:
+			wg.Wait()
+			var err error
+			if s.OnStop != nil {
+				err = s.OnStop()
+			}
+			reply(req.ID, nil, err)
+			return err
+		default:
+			reply(req.ID, nil, errors.New("unknown method "+req.Method))
+		}
+	}
+}
+
+// handle answers the calls that may run concurrently.
+func (s *Server) handle(req Request, reply func(id uint64, result interface{}, err error)) {
+	switch req.Method {
+	case MethodHTTP:
+		var r HTTPRequest
+		if err := json.Unmarshal(req.Params, &r); err != nil {
+			reply(req.ID, nil, err)
+			return
+		}
+		if s.OnHTTP == nil {
+			reply(req.ID, HTTPResponse{Status: 404}, nil)
+			return
+		}
+		reply(req.ID, s.OnHTTP(r), nil)
+	case MethodTask:
+		var t Task
+		err := json.Unmarshal(req.Params, &t)
+		if err == nil && s.OnTask != nil {
+			err = s.OnTask(t.Name)
+		}
+		reply(req.ID, nil, err)
+	}
+}
@@ -25,9 +25,14 @@ func (m *Module[T]) Name() string {
 	return "Single"
 }
 
+// Config returns the configuration section of the lifecycle, see service.ModuleConfig.
+func (m *Module[T]) Config() any {
+	return m.lifecycle.Config
+}
+
 func (m *Module[T]) Tasks() []service.Task {
-	tasks := make([]service.Task, 0)
-	return tasks
+	tasks := make([]service.Task, 0, len(m.lifecycle.Tasks))
+	return append(tasks, m.lifecycle.Tasks...)
 }
 
 func (m *Module[T]) Load(zdi.Invoker) (any, error) {
@@ -47,12 +52,48 @@ func (m *Module[T]) Start(zdi.Invoker) (err error) {
 func (m *Module[T]) Done(zdi.Invoker) (err error) {
 	if m.lifecycle.Done != nil {
 		m.instance, err = m.lifecycle.Done(m.DI)
+		if err == nil {
+			err = m.exportInstance()
+		}
 		return
 	}
 	return
 }
 
+func (m *Module[T]) Stop(di zdi.Invoker) error {
+	if m.lifecycle.Stop != nil {
+		return m.lifecycle.Stop(di)
+	}
+	return nil
+}
+
+func (m *Module[T]) Reload(di zdi.Invoker) error {
+	if m.lifecycle.Reload != nil {
+		return m.lifecycle.Reload(di)
+	}
+	return nil
+}
+
 func (m *Module[T]) Controller() []service.Controller {
-	controllers := make([]service.Controller, 0)
-	return controllers
+	controllers := make([]service.Controller, 0, len(m.lifecycle.Controllers))
+	return append(controllers, m.lifecycle.Controllers...)
+}
+
+// exportInstance exports the instance returned by Done as T,
+// so other modules can resolve it without calling Instance.
+func (m *Module[T]) exportInstance() error {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() == reflect.Interface && typ.NumMethod() == 0 {
+		return nil
+	}
+
+	val := reflect.ValueOf(&m.instance).Elem()
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if val.IsNil() {
+			return nil
+		}
+	}
+
+	return service.ExportAs(m.DI, (*T)(nil), m.instance)
 }
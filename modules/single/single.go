@@ -2,13 +2,19 @@ package single
 
 import (
 	"github.com/sohaha/zlsgo/zdi"
+	"github.com/zlsgo/app_core/service"
 )
 
 type Lifecycle[T any] struct {
-	Name  string
-	Load  func(zdi.Invoker) (any, error)
-	Start func(zdi.Invoker) error
-	Done  func(zdi.Invoker) (T, error)
+	Name        string
+	Config      any
+	Load        func(zdi.Invoker) (any, error)
+	Start       func(zdi.Invoker) error
+	Done        func(zdi.Invoker) (T, error)
+	Stop        func(zdi.Invoker) error
+	Reload      func(zdi.Invoker) error
+	Tasks       []service.Task
+	Controllers []service.Controller
 }
 
 func New[T any](s Lifecycle[T]) *Module[T] {
@@ -12,9 +12,11 @@ import (
 
 // App represents an application.
 type App struct {
-	DI   zdi.Invoker  // Dependency injection invoker.
-	Conf *Conf        // Application configuration.
-	Log  *zlog.Logger // Logger instance.
+	DI      zdi.Invoker     // Dependency injection invoker.
+	Conf    *Conf           // Application configuration.
+	Log     *zlog.Logger    // Logger instance.
+	modules *moduleRegistry // modules keeps track of the initialized modules.
+	bus     *eventBus       // bus delivers the module lifecycle events.
 }
 
 var (
@@ -60,7 +62,11 @@ func NewApp(opt ...func(o BaseConf) BaseConf) func(di zdi.Injector) *App {
 			Conf: conf,
 			Log:  setLog(log, conf),
 		}
-		_ = di.Maps(di, conf, Global)
+		// Modules hold a copy of the App, the shared state must exist before they are assigned.
+		Global.registry()
+		Global.events()
+		Global.DI = Global.sharedInjector()
+		_ = di.Maps(Global.DI, conf, Global)
 		return Global
 	}
 }
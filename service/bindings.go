@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/znet"
+)
+
+// binding is a value contributed by a module to a named or collection binding.
+type binding struct {
+	value reflect.Value
+	typ   reflect.Type
+	owner string
+	name  string // name is empty for collection bindings.
+	used  bool   // used reports whether a bound middleware is already used by the Web.
+}
+
+// BindNamed binds the value under name, the named values of T are shared
+// through the application injector as map[string]T and resolved with ResolveNamed.
+// di is the injector the module received, a name can only be bound once per type.
+// A map[string]T mapped into the application injector is resolved instead of the named values,
+// ResolveNamed also finds the values of the map mapped before the first binding of T.
+func BindNamed[T any](di zdi.Invoker, name string, value T) error {
+	if name == "" {
+		return errors.New("binding name is required")
+	}
+	return bind(di, typeOf[T](), name, reflect.ValueOf(&value).Elem())
+}
+
+// BindAppend appends the values to the collection of T, the collection is shared
+// through the application injector as []T in contribution order and resolved with ResolveAll.
+// A []T mapped into the application injector is resolved instead of the collection,
+// ResolveAll returns its values mapped before the first binding of T followed by the collection.
+func BindAppend[T any](di zdi.Invoker, values ...T) error {
+	for i := range values {
+		if err := bind(di, typeOf[T](), "", reflect.ValueOf(&values[i]).Elem()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveNamed returns the value of T bound under name.
+func ResolveNamed[T any](di zdi.Invoker, name string) (value T, err error) {
+	var named map[string]T
+	if v, ok := resolveBound(di, reflect.MapOf(reflect.TypeOf(""), typeOf[T]())); ok {
+		named = v.Interface().(map[string]T)
+	} else {
+		_ = di.Resolve(&named)
+	}
+	value, ok := named[name]
+	if !ok {
+		err = errors.New("no " + typeOf[T]().String() + " bound as " + name)
+	}
+	return
+}
+
+// ResolveAll returns the collection of T, nil if nothing was appended.
+func ResolveAll[T any](di zdi.Invoker) []T {
+	if v, ok := resolveBound(di, reflect.SliceOf(typeOf[T]())); ok {
+		return v.Interface().([]T)
+	}
+	var all []T
+	_ = di.Resolve(&all)
+	return all
+}
+
+// resolveBound returns the []T or map[string]T t of the bindings of the application of di.
+func resolveBound(di zdi.Invoker, t reflect.Type) (reflect.Value, bool) {
+	var app *App
+	if s, ok := di.(*moduleScope); ok {
+		app = s.app
+	} else if err := di.Resolve(&app); err != nil {
+		return reflect.Value{}, false
+	}
+	return app.registry().collect(t)
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func bind(di zdi.Invoker, t reflect.Type, name string, v reflect.Value) error {
+	var (
+		app   *App
+		owner string
+	)
+	if s, ok := di.(*moduleScope); ok {
+		app, owner = s.app, s.name
+	} else if err := di.Resolve(&app); err != nil {
+		return errors.New("binding requires the application injector")
+	}
+
+	// The bindings are resolved through the shared values, the []T and map[string]T
+	// resolved before the first binding of T stay part of them.
+	_ = app.exports()
+	r := app.registry()
+	r.mu.RLock()
+	_, ok := r.bindingBases[t]
+	r.mu.RUnlock()
+	var base [2]reflect.Value
+	if !ok {
+		inj := app.sharedInjector()
+		base[0], _ = inj.Get(reflect.SliceOf(t))
+		base[1], _ = inj.Get(reflect.MapOf(reflect.TypeOf(""), t))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name != "" {
+		for _, b := range r.bindings {
+			if b.typ == t && b.name == name {
+				msg := t.String() + " " + strconv.Quote(name) + " is already bound"
+				if b.owner != "" {
+					msg += " by " + b.owner + " module"
+				}
+				return errors.New(msg)
+			}
+		}
+	}
+	if _, ok := r.bindingBases[t]; !ok {
+		if r.bindingBases == nil {
+			r.bindingBases = make(map[reflect.Type][2]reflect.Value)
+		}
+		r.bindingBases[t] = base
+	}
+	r.bindings = append(r.bindings, binding{value: v, typ: t, owner: owner, name: name})
+	return nil
+}
+
+// useBoundMiddleware adds the middleware appended by the modules since the Web was created to it,
+// so the routes bound afterwards run it.
+func (app *App) useBoundMiddleware(web *Web) {
+	if web == nil {
+		return
+	}
+	for _, h := range app.registry().takeMiddleware() {
+		web.Use(h)
+	}
+}
+
+// takeMiddleware returns the appended middleware not used by the Web yet and marks it as used.
+func (r *moduleRegistry) takeMiddleware() []znet.Handler {
+	t := typeOf[znet.Handler]()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var handlers []znet.Handler
+	for i := range r.bindings {
+		b := &r.bindings[i]
+		if b.typ != t || b.name != "" || b.used {
+			continue
+		}
+		b.used = true
+		handlers = append(handlers, b.value.Interface().(znet.Handler))
+	}
+	return handlers
+}
+
+// unbindModule removes the values contributed by the module.
+func (app *App) unbindModule(owner string) {
+	r := app.registry()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bindings := r.bindings[:0]
+	for _, b := range r.bindings {
+		if b.owner != owner {
+			bindings = append(bindings, b)
+		}
+	}
+	r.bindings = bindings
+}
+
+// collect returns a fresh []T or map[string]T of the bindings of T when t is one of them
+// and T was bound, the values mapped before the first binding of T come first.
+func (r *moduleRegistry) collect(t reflect.Type) (reflect.Value, bool) {
+	var elem reflect.Type
+	switch {
+	case t.Kind() == reflect.Slice:
+		elem = t.Elem()
+	case t.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		elem = t.Elem()
+	default:
+		return reflect.Value{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	base, ok := r.bindingBases[elem]
+	if !ok {
+		return reflect.Value{}, false
+	}
+
+	if t.Kind() == reflect.Slice {
+		all := reflect.MakeSlice(t, 0, 0)
+		if base[0].IsValid() && base[0].Type() == t {
+			all = reflect.AppendSlice(all, base[0])
+		}
+		for _, b := range r.bindings {
+			if b.typ == elem && b.name == "" {
+				all = reflect.Append(all, b.value)
+			}
+		}
+		return all, true
+	}
+
+	named := reflect.MakeMap(t)
+	if base[1].IsValid() && base[1].Type() == t {
+		iter := base[1].MapRange()
+		for iter.Next() {
+			named.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	for _, b := range r.bindings {
+		if b.typ == elem && b.name != "" {
+			named.SetMapIndex(reflect.ValueOf(b.name), b.value)
+		}
+	}
+	return named, true
+}
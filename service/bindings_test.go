@@ -0,0 +1,102 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/znet"
+)
+
+type testController struct {
+	Path string
+}
+
+func (c *testController) Init(r *znet.Engine) error {
+	return nil
+}
+
+func (c *testController) GetPing(z *znet.Context) {
+	z.String(http.StatusOK, "pong")
+}
+
+func TestBindAppendMiddleware(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	header := func(key string) znet.Handler {
+		return func(c *znet.Context) {
+			c.SetHeader(key, "1")
+			c.Next()
+		}
+	}
+	_ = app.DI.(zdi.Injector).Map([]znet.Handler{header("X-App")})
+
+	mod := &testModule{name: "web", ModuleLifeCycle: ModuleLifeCycle{
+		OnLoad: func(di zdi.Invoker) (any, error) {
+			var web *Web
+			if err := di.Resolve(&web); err != nil {
+				return nil, err
+			}
+			return nil, BindAppend(di, header("X-Module"))
+		},
+		Service: &ModuleService{Controllers: []Controller{&testController{Path: "/test"}}},
+	}}
+	if err := InitModule([]Module{mod}, app); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(ResolveAll[znet.Handler](app.DI)); n != 2 {
+		t.Fatalf("expected 2 middlewares, got %d", n)
+	}
+
+	web, _ := getWeb(app)
+	w := httptest.NewRecorder()
+	web.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test/ping", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "pong" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	for _, key := range []string{"X-App", "X-Module"} {
+		if w.Header().Get(key) != "1" {
+			t.Fatalf("middleware %s did not run", key)
+		}
+	}
+}
+
+func TestBindNamedWhileResolving(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	if err := InitModule(nil, app); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			var conf *Conf
+			_ = app.DI.Resolve(&conf)
+			_, _ = ResolveNamed[*testValueA](app.DI, "a")
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		mod := &testModule{name: "named", ModuleLifeCycle: ModuleLifeCycle{
+			OnLoad: func(di zdi.Invoker) (any, error) {
+				return nil, BindNamed(di, "a", &testValueA{i})
+			},
+		}}
+		if err := app.RegisterModule(mod); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := ResolveNamed[*testValueA](app.DI, "a"); err != nil || v.n != i {
+			t.Fatalf("expected the value bound by the module, got %v %v", v, err)
+		}
+		if err := app.UnregisterModule("named"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	if _, err := ResolveNamed[*testValueA](app.DI, "a"); err == nil {
+		t.Fatal("expected the named value to be unbound")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/sohaha/zlsgo/zlog"
 	"github.com/sohaha/zlsgo/znet"
 	"github.com/sohaha/zlsgo/ztype"
+	"github.com/spf13/viper"
 	gconf "github.com/zlsgo/conf"
 )
 
@@ -63,7 +64,16 @@ type BaseConf struct {
 	DisableDebug bool `z:"-"`
 
 	// LogMaxAge log max age
-	LogMaxAge int `z:"log_max_age,omitempty"`
+	LogMaxAge int `z:"log_max_age,omitempty" validate:"min=0"`
+
+	// ShutdownTimeout is the number of seconds each module has to stop.
+	ShutdownTimeout int `z:"shutdown_timeout,omitempty" validate:"min=0"`
+
+	// StrictDI refuses to start when two modules provide the same DI type.
+	StrictDI bool `z:"strict_di,omitempty"`
+
+	// ParallelStart is the number of modules started concurrently, 0 or 1 starts them one by one.
+	ParallelStart int `z:"parallel_start,omitempty" validate:"min=0"`
 }
 
 func init() {
@@ -150,10 +160,11 @@ var (
 var (
 	DefaultConf []interface{}
 	baseConf    = BaseConf{
-		Debug:     debug,
-		Zone:      8,
-		Port:      "3788",
-		HotReload: true,
+		Debug:           debug,
+		Zone:            8,
+		Port:            "3788",
+		HotReload:       true,
+		ShutdownTimeout: 10,
 	}
 )
 
@@ -163,47 +174,98 @@ type Conf struct {
 
 	Base          BaseConf      // Base represents the base configuration settings.
 	autoUnmarshal func()        `z:"-"`
-	reloads       []interface{} `z:"-"`
+	reloads       []reloadHook  `z:"-"`
+	sections      []interface{} `z:"-"`
+	watcher       *confWatcher  `z:"-"`
+	layers        []*confLayer  `z:"-"`
+	env           string        `z:"-"`
+	good          []byte        `z:"-"`
+	resolved      ztype.Map     `z:"-"`
+	defaults      ztype.Map     `z:"-"` // defaults are the writable defaults, written with the config file.
+	changes       ztype.Map     `z:"-"` // changes are the values of Conf.Set, written with the config file.
+	overrides     []string      `z:"-"`
+	envVars       bool          `z:"-"`
+	printConf     bool          `z:"-"`
 }
 
-// Get retrieves the value associated with the given key from the Conf object.
+// Get retrieves the value associated with the given key from the Conf object,
+// with its secret references resolved.
 func (c *Conf) Get(key string) ztype.Type {
-	return c.cfg.GetAll().Get(key)
+	return c.all().Get(key)
 }
 
 // Set updates the value of a configuration key.
+// A secret reference that can not be resolved is logged, Get keeps the values resolved before.
 func (c *Conf) Set(key string, value interface{}) {
 	c.cfg.Set(key, value)
+	if c.changes == nil {
+		c.changes = ztype.Map{}
+	}
+	c.changes[key] = value
+	c.overrides = append(c.overrides, strings.ToLower(key))
+	if err := c.resolve(); err != nil {
+		zlog.Error(err)
+	}
 }
 
 // Unmarshal unmarshals the value associated with the given key in the Conf struct.
 // It takes a string key and a pointer to an interface{} as its parameters.
 func (c *Conf) Unmarshal(key string, rawVal interface{}) error {
-	return c.cfg.UnmarshalKey(key, &rawVal)
+	return c.unmarshalKey(key, &rawVal)
 }
 
 // NewConf creates a new Conf object with the given options.
+//
+// The configuration is merged from these sources, each overriding the previous ones:
+// the defaults, the base config file (named after the binary, or --config path),
+// the environment-specific file <name>-<env> selected by <AppName>_ENV or APP_ENV (dev by default),
+// the local file <name>.local, the environment variables <AppName>_<SECTION>_<KEY>
+// and the repeatable --set key=value flags. The flags are only read from ConfArgs.
 func NewConf(opt ...func(o gconf.Options) gconf.Options) func(di zdi.Injector) *Conf {
-	cfg := gconf.New(ConfFileName, func(o gconf.Options) gconf.Options {
+	flags, err := parseConfFlags(ConfArgs)
+	common.Fatal(err)
+
+	file := ConfFileName
+	if flags.file != "" {
+		file = flags.file
+	}
+
+	env := confEnv()
+	cfg := gconf.New(file, func(o gconf.Options) gconf.Options {
 		o.EnvPrefix = AppName
 		o.AutoCreate = true
-		o.PrimaryAliss = "dev"
+		o.PrimaryAliss = env
 		for i := range opt {
 			o = opt[i](o)
 		}
+		// The environment-specific file is merged as a layer next to the config file.
+		env, o.PrimaryAliss = o.PrimaryAliss, ""
 		return o
 	})
 
 	return func(di zdi.Injector) *Conf {
-		c := &Conf{cfg: cfg}
+		c := &Conf{cfg: cfg, env: env, printConf: flags.print}
+		for _, f := range layerFiles(cfg.Path(), env) {
+			c.layers = append(c.layers, &confLayer{file: f})
+		}
 
 		delay, autoUnmarshal := setConf(c, DefaultConf)
 
-		common.Fatal(cfg.Read())
+		common.Fatal(c.read())
+		c.keepGood()
+		// Environment variables and flags apply after the config file may have been created from the defaults.
+		cfg.Core.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+		cfg.Core.AutomaticEnv()
+		c.envVars = true
+		for _, kv := range flags.sets {
+			cfg.Core.Set(kv[0], kv[1])
+			c.overrides = append(c.overrides, kv[0])
+		}
 		delay()
+		common.Fatal(c.resolve())
 		autoUnmarshal()
 
-		common.Fatal(cfg.Unmarshal(&c))
+		common.Fatal(ztype.To(c.all(), &c))
 
 		// Because the basic configuration is not a pointer type, we need to reassign it here.
 		baseConf = baseConf.fix(cfg, c.Base)
@@ -211,6 +273,8 @@ func NewConf(opt ...func(o gconf.Options) gconf.Options) func(di zdi.Injector) *
 
 		c.autoUnmarshal = autoUnmarshal
 
+		common.Fatal(c.validate())
+
 		ztime.SetTimeZone(int(c.Base.Zone))
 
 		return c
@@ -227,8 +291,33 @@ func RegisterDefaultConf(conf DefaultConfValue) {
 	DefaultConf = append(DefaultConf, conf)
 }
 
+// Write writes the configuration to the config file, secret references are written
+// as they are, never their resolved values.
+// Only the content of the config file, the writable defaults and the values of Set are written,
+// the environment-specific and local files, the environment variables and the --set flags are left out.
 func (c *Conf) Write() error {
-	return c.cfg.Write()
+	w := gconf.New(c.cfg.Path())
+	for k, v := range c.defaults {
+		w.SetDefault(k, v)
+	}
+	if err := w.Read(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return err
+		}
+	}
+	for k, v := range c.changes {
+		w.Core.Set(k, v)
+	}
+	return w.Write()
+}
+
+// setDefault registers a writable default.
+func (c *Conf) setDefault(key string, value interface{}) {
+	if c.defaults == nil {
+		c.defaults = ztype.Map{}
+	}
+	c.defaults[key] = value
+	c.cfg.SetDefault(key, value)
 }
 
 func getConfName(t reflect.Value) (key string, isVar bool) {
@@ -254,9 +343,10 @@ func getConfName(t reflect.Value) (key string, isVar bool) {
 
 func setConf(conf *Conf, value []interface{}) (func(), func()) {
 	confs, disableDebug, autoUnmarshal := ztype.Map{}, false, []func(){}
+	conf.sections = value
 	setConf := func(disableWrite bool) func(key string, value interface{}) {
 		if !disableWrite {
-			return conf.cfg.SetDefault
+			return conf.setDefault
 		}
 		return func(key string, value interface{}) {
 			confs[key] = value
@@ -279,8 +369,11 @@ func setConf(conf *Conf, value []interface{}) (func(), func()) {
 
 		r := v.MethodByName("Reload")
 		if r.IsValid() && r.Kind() == reflect.Func {
-			// TODO: 考虑使用 reflect.DeepEqual 来判断是否需要通知
-			conf.reloads = append(conf.reloads, r.Interface())
+			hook := reloadHook{fn: r.Interface(), key: strings.ToLower(name)}
+			if p := v.MethodByName("PrepareReload"); p.IsValid() {
+				hook.prepare = p.Interface()
+			}
+			conf.reloads = append(conf.reloads, hook)
 		}
 
 		set := setConf(disableWrite)
@@ -292,7 +385,8 @@ func setConf(conf *Conf, value []interface{}) (func(), func()) {
 			if name == "base" {
 				disableDebug = m.Get("DisableDebug").Bool()
 			}
-			set(name, m)
+			// A plain map lets the keys of the section be overridden one by one.
+			set(name, map[string]interface{}(m))
 		case reflect.Slice:
 			switch typ.Elem().Kind() {
 			case reflect.Struct:
@@ -310,7 +404,7 @@ func setConf(conf *Conf, value []interface{}) (func(), func()) {
 
 		if isPtr {
 			autoUnmarshal = append(autoUnmarshal, func() {
-				_ = conf.cfg.UnmarshalKey(name, value[i], true)
+				_ = conf.unmarshalKey(name, value[i])
 			})
 		}
 	}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sohaha/zlsgo/zdi"
+)
+
+// testConfFile writes the config file of the test into a temporary directory, NewConf reads it until the test ends.
+func testConfFile(t *testing.T, content string) string {
+	t.Helper()
+	file, args, base := ConfFileName, ConfArgs, baseConf
+	t.Cleanup(func() { ConfFileName, ConfArgs, baseConf = file, args, base })
+
+	ConfFileName = filepath.Join(t.TempDir(), "app.toml")
+	ConfArgs = nil
+	if err := os.WriteFile(ConfFileName, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return ConfFileName
+}
+
+func TestConfWriteLeavesOverridesOut(t *testing.T) {
+	dir := t.TempDir()
+	file, args, base := ConfFileName, ConfArgs, baseConf
+	defer func() { ConfFileName, ConfArgs, baseConf = file, args, base }()
+
+	ConfFileName = filepath.Join(dir, "app.toml")
+	ConfArgs = []string{"--set", "base.port=9999"}
+	t.Setenv(strings.ToUpper(AppName)+"_DB_HOST", "envhost")
+	if err := os.WriteFile(ConfFileName, []byte("[db]\nhost = 'filehost'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.local.toml"), []byte("[db]\nuser = 'local'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConf()(zdi.New())
+	if c.Get("db.host").String() != "envhost" || c.Get("base.port").String() != "9999" {
+		t.Fatalf("unexpected configuration %v", c.all())
+	}
+	c.Set("db.name", "app")
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(ConfFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(b)
+	for _, s := range []string{"9999", "envhost", "local"} {
+		if strings.Contains(content, s) {
+			t.Fatalf("%q written to the config file:\n%s", s, content)
+		}
+	}
+	for _, s := range []string{"filehost", "name = 'app'"} {
+		if !strings.Contains(content, s) {
+			t.Fatalf("%q missing from the config file:\n%s", s, content)
+		}
+	}
+}
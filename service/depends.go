@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+// ModuleDepends is implemented by modules that must be initialized after other modules.
+// DependsOn returns the names of the modules it depends on.
+type ModuleDepends interface {
+	DependsOn() []string
+}
+
+// getModuleDepends returns the declared dependencies of the module, without duplicates.
+func getModuleDepends(mod Module) []string {
+	d, ok := mod.(ModuleDepends)
+	if !ok {
+		return nil
+	}
+
+	deps := make([]string, 0)
+	for _, name := range d.DependsOn() {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		exist := false
+		for i := range deps {
+			if deps[i] == name {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			deps = append(deps, name)
+		}
+	}
+	return deps
+}
+
+// sortModules orders the module names so that every module comes after its dependencies,
+// modules without ordering constraints between them keep the given order.
+func sortModules(names []string, deps map[string][]string) ([]string, error) {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+
+	exists := make(map[string]bool, len(sorted))
+	for _, name := range sorted {
+		exists[name] = true
+	}
+
+	for _, name := range sorted {
+		for _, dep := range deps[name] {
+			if !exists[dep] {
+				return nil, errors.New(name + " module: missing dependency " + dep)
+			}
+		}
+	}
+
+	ordered := make([]string, 0, len(sorted))
+	done := make(map[string]bool, len(sorted))
+	for len(ordered) < len(sorted) {
+		next := ""
+		for _, name := range sorted {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[name] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = name
+				break
+			}
+		}
+
+		if next == "" {
+			return nil, errors.New("module dependency cycle: " + strings.Join(findCycle(sorted, deps, done), " -> "))
+		}
+
+		done[next] = true
+		ordered = append(ordered, next)
+	}
+
+	return ordered, nil
+}
+
+// findCycle returns one dependency cycle among the modules that have not been resolved yet.
+func findCycle(names []string, deps map[string][]string, done map[string]bool) []string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int, len(names))
+	path := make([]string, 0, len(names))
+
+	var walk func(name string) []string
+	walk = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if done[dep] {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				for i := range path {
+					if path[i] == dep {
+						cycle := make([]string, 0, len(path)-i+1)
+						cycle = append(cycle, path[i:]...)
+						return append(cycle, dep)
+					}
+				}
+			case 0:
+				if cycle := walk(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range names {
+		if done[name] || state[name] != 0 {
+			continue
+		}
+		if cycle := walk(name); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// moduleLayers groups the ordered module names into layers,
+// the modules of a layer only depend on modules of the previous layers.
+func moduleLayers(ordered []string, deps map[string][]string) [][]string {
+	depth := make(map[string]int, len(ordered))
+	layers := make([][]string, 0)
+	for _, name := range ordered {
+		d := 0
+		for _, dep := range deps[name] {
+			if depth[dep]+1 > d {
+				d = depth[dep] + 1
+			}
+		}
+		depth[name] = d
+		if d == len(layers) {
+			layers = append(layers, nil)
+		}
+		layers[d] = append(layers[d], name)
+	}
+	return layers
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortModules(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		names []string
+		deps  map[string][]string
+		want  []string
+		err   string
+	}{
+		{
+			name:  "no dependencies keep the order",
+			names: []string{"c", "a", "b"},
+			want:  []string{"c", "a", "b"},
+		},
+		{
+			name:  "dependencies come first",
+			names: []string{"a", "b", "c"},
+			deps:  map[string][]string{"a": {"c"}, "b": {"a"}},
+			want:  []string{"c", "a", "b"},
+		},
+		{
+			name:  "shared dependency",
+			names: []string{"api", "cache", "db", "web"},
+			deps:  map[string][]string{"api": {"db", "cache"}, "cache": {"db"}, "web": {"api"}},
+			want:  []string{"db", "cache", "api", "web"},
+		},
+		{
+			name:  "missing dependency",
+			names: []string{"a", "b"},
+			deps:  map[string][]string{"b": {"x"}},
+			err:   "b module: missing dependency x",
+		},
+		{
+			name:  "self dependency",
+			names: []string{"a"},
+			deps:  map[string][]string{"a": {"a"}},
+			err:   "module dependency cycle: a -> a",
+		},
+		{
+			name:  "cycle",
+			names: []string{"a", "b", "c", "d"},
+			deps:  map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}, "d": {"a"}},
+			err:   "module dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name:  "cycle behind resolved modules",
+			names: []string{"a", "b", "c"},
+			deps:  map[string][]string{"b": {"a", "c"}, "c": {"b"}},
+			err:   "module dependency cycle: b -> c -> b",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sortModules(tt.names, tt.deps)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected %q, got %v %v", tt.err, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetModuleDepends(t *testing.T) {
+	if deps := getModuleDepends(&testModule{name: "a"}); deps != nil {
+		t.Fatalf("expected no dependencies, got %v", deps)
+	}
+	mod := &testDependent{deps: []string{"db", " cache ", "", "db"}}
+	if deps := getModuleDepends(mod); !reflect.DeepEqual(deps, []string{"db", "cache"}) {
+		t.Fatalf("unexpected dependencies %v", deps)
+	}
+}
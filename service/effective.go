@@ -0,0 +1,299 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sohaha/zlsgo/znet"
+	"github.com/sohaha/zlsgo/zreflect"
+	"github.com/sohaha/zlsgo/ztype"
+	"github.com/spf13/viper"
+)
+
+// Sources of a configuration value, from the lowest to the highest precedence.
+const (
+	ConfFromDefault  = "default"
+	ConfFromFile     = "file"
+	ConfFromEnv      = "env"
+	ConfFromOverride = "override"
+)
+
+// Redacted replaces the values of secret-looking keys in the effective configuration.
+const Redacted = "******"
+
+// ErrConfPrinted is returned by InitModule once the effective configuration is printed for --print-config,
+// no module is loaded and the application is expected to exit.
+var ErrConfPrinted = errors.New("effective configuration printed")
+
+var (
+	// ConfPath is the route of the JSON effective configuration, empty disables it.
+	ConfPath = ""
+
+	// ConfRedactWords are the words of a key, separated by _ - or a dot, that mark its value as a secret.
+	// Words of five letters or more also match inside a word, e.g. dbpassword.
+	ConfRedactWords = []string{
+		"pass", "pwd", "passwd", "password", "secret", "token", "credential", "credentials",
+		"apikey", "privatekey", "accesskey", "secretkey", "private", "auth", "cookie", "salt",
+	}
+)
+
+// ConfValue is a value of the effective configuration and where it came from.
+type ConfValue struct {
+	Value interface{} `json:"value"`
+	Key   string      `json:"key"`
+	// Source is one of ConfFromDefault, ConfFromFile, ConfFromEnv and ConfFromOverride.
+	Source string `json:"source"`
+	// File is the config file of the value when it came from a file.
+	File     string `json:"file,omitempty"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+// EffectiveConf returns the configuration the application runs with, sorted by key:
+// the merged settings, the BaseConf, DefaultConf and module config sections,
+// with the source of every value. Secret-looking keys and values read from secret references are redacted.
+func (app *App) EffectiveConf() []ConfValue {
+	c := app.Conf
+	if c == nil || c.cfg == nil {
+		return nil
+	}
+
+	files := c.fileSettings()
+	raw := c.cfg.GetAll()
+	values := make([]ConfValue, 0)
+	seen := make(map[string]struct{})
+	add := func(key string, value interface{}) {
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+
+		v := ConfValue{Key: key, Value: value, Source: ConfFromDefault}
+		switch {
+		case c.overridden(key):
+			v.Source = ConfFromOverride
+		case c.fromEnv(key):
+			v.Source = ConfFromEnv
+		default:
+			for i := len(files) - 1; i >= 0; i-- {
+				if ztype.Map(files[i].data).Get(key).Exists() {
+					v.Source, v.File = ConfFromFile, files[i].file
+					break
+				}
+			}
+		}
+		if isSecretKey(key) || isSecretRef(raw.Get(key).Value()) {
+			v.Value, v.Redacted = Redacted, true
+		}
+		values = append(values, v)
+	}
+
+	flattenConf("", map[string]interface{}(c.all()), add)
+
+	sections := map[string]interface{}{"base": c.Base}
+	for _, s := range c.sections {
+		name, _ := getConfName(reflect.ValueOf(s))
+		sections[strings.ToLower(name)] = s
+	}
+	for _, e := range app.registry().all() {
+		if e.config != nil {
+			sections[e.config.key] = e.config.value.Interface()
+		}
+	}
+	for key, s := range sections {
+		sectionLeaves(key, reflect.ValueOf(s), func(k string, value interface{}) {
+			// Only the keys of a section missing from the settings, e.g. omitted zero values, are added.
+			for p := k; p != key; p = p[:strings.LastIndexByte(p, '.')] {
+				if _, ok := seen[p]; ok {
+					return
+				}
+			}
+			add(k, value)
+		})
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+// PrintEffectiveConf writes the effective configuration, one key = value per line with its source.
+func (app *App) PrintEffectiveConf(w io.Writer) error {
+	var b strings.Builder
+	for _, v := range app.EffectiveConf() {
+		value, err := json.Marshal(v.Value)
+		if err != nil {
+			value = []byte(ztype.ToString(v.Value))
+		}
+		b.WriteString(v.Key + " = " + string(value) + "  # " + v.Source)
+		if v.File != "" {
+			b.WriteString(" " + v.File)
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printConf prints the effective configuration when --print-config is in ConfArgs and returns ErrConfPrinted,
+// or the errors of the configuration sections of the modules.
+// It runs before any module is loaded, only the configuration sections of the modules are bound.
+func (app *App) printConf(entries []*moduleEntry) error {
+	if app.Conf == nil || !app.Conf.printConf {
+		return nil
+	}
+	var errs ModuleErrors
+	for _, e := range entries {
+		if err := app.bindModuleConf(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := app.PrintEffectiveConf(os.Stdout); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return ErrConfPrinted
+}
+
+// confHandler renders the effective configuration.
+func confHandler(app *App) znet.Handler {
+	return func(c *znet.Context) {
+		c.JSON(http.StatusOK, app.EffectiveConf())
+	}
+}
+
+// fileSettings returns the settings of the config files in effect, from the lowest to the highest precedence.
+func (c *Conf) fileSettings() []confLayer {
+	files := make([]confLayer, 0, len(c.layers)+1)
+	if file := c.cfg.Core.ConfigFileUsed(); file != "" && len(c.good) > 0 {
+		v := viper.New()
+		v.SetConfigType(strings.TrimPrefix(filepath.Ext(file), "."))
+		if err := v.ReadConfig(bytes.NewReader(c.good)); err == nil {
+			files = append(files, confLayer{file: file, data: v.AllSettings()})
+		}
+	}
+	for _, l := range c.layers {
+		if l.data != nil {
+			files = append(files, *l)
+		}
+	}
+	return files
+}
+
+// overridden reports whether the key was set by --set or Conf.Set.
+func (c *Conf) overridden(key string) bool {
+	for _, o := range c.overrides {
+		if key == o || strings.HasPrefix(key, o+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// fromEnv reports whether an environment variable overrides the key.
+func (c *Conf) fromEnv(key string) bool {
+	if !c.envVars {
+		return false
+	}
+	_, ok := os.LookupEnv(strings.ToUpper(AppName + "_" + strings.ReplaceAll(key, ".", "_")))
+	return ok
+}
+
+// flattenConf calls fn for every leaf of the settings, the elements of a list are keyed by their index.
+func flattenConf(key string, v interface{}, fn func(key string, value interface{})) {
+	if l := reflect.ValueOf(v); l.Kind() == reflect.Slice && l.Type().Elem().Kind() != reflect.Uint8 && l.Len() > 0 {
+		for i := 0; i < l.Len(); i++ {
+			flattenConf(joinKey(key, strconv.Itoa(i)), l.Index(i).Interface(), fn)
+		}
+		return
+	}
+
+	m, ok := confMap(v)
+	if !ok || len(m) == 0 {
+		if key != "" {
+			fn(key, v)
+		}
+		return
+	}
+	for k := range m {
+		flattenConf(joinKey(key, strings.ToLower(k)), m[k], fn)
+	}
+}
+
+// sectionLeaves calls fn for every field of the section that is not a struct or a list itself,
+// the elements of a list are keyed by their index.
+func sectionLeaves(key string, v reflect.Value, fn func(key string, value interface{})) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 && v.Len() > 0 {
+		for i := 0; i < v.Len(); i++ {
+			sectionLeaves(joinKey(key, strconv.Itoa(i)), v.Index(i), fn)
+		}
+		return
+	}
+	if v.Kind() != reflect.Struct {
+		fn(key, v.Interface())
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			sectionLeaves(key, v.Field(i), fn)
+			continue
+		}
+		name, _ := zreflect.GetStructTag(f)
+		if name == "" {
+			if f.Tag.Get("z") == "-" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			name = f.Name
+		}
+		sectionLeaves(joinKey(key, strings.ToLower(name)), v.Field(i), fn)
+	}
+}
+
+// isSecretKey reports whether a segment of the key contains one of the ConfRedactWords.
+func isSecretKey(key string) bool {
+	for _, segment := range strings.Split(strings.ToLower(key), ".") {
+		words := strings.FieldsFunc(segment, func(r rune) bool { return r == '_' || r == '-' })
+		compact := strings.Join(words, "")
+		for _, w := range ConfRedactWords {
+			if len(w) >= 5 && strings.Contains(compact, w) {
+				return true
+			}
+			for i := range words {
+				if words[i] == w {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isSecretRef reports whether the raw value is read from a secret reference.
+func isSecretRef(v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	return strings.HasPrefix(s, EncryptedPrefix) || strings.Contains(s, "${env:") || strings.Contains(s, "${file:")
+}
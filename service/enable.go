@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sohaha/zlsgo/zerror"
+)
+
+// ModuleCritical is implemented by modules that cannot be enabled or disabled
+// while the application is running, toggling them requires a restart.
+type ModuleCritical interface {
+	Critical() bool
+}
+
+// moduleEnabled reports whether the module is enabled by the modules.<name>.enabled option,
+// modules are enabled unless the option is set to false.
+func (c *Conf) moduleEnabled(name string) bool {
+	if c == nil || c.cfg == nil {
+		return true
+	}
+	v := c.all().Get("modules." + strings.ToLower(name) + ".enabled")
+	if !v.Exists() {
+		return true
+	}
+	return v.Bool()
+}
+
+func isCriticalModule(mod Module) bool {
+	c, ok := mod.(ModuleCritical)
+	return ok && c.Critical()
+}
+
+// toggleModules enables or disables the modules whose option changed since they were initialized.
+func (app *App) toggleModules(web *Web) {
+	if !app.Conf.Base.HotReload {
+		return
+	}
+
+	r := app.registry()
+	r.op.Lock()
+	defer r.op.Unlock()
+
+	entries := r.all()
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.active.Load() && !app.Conf.moduleEnabled(e.name) {
+			if isCriticalModule(e.mod) {
+				app.Log.Warn(e.name + " module: critical module can only be disabled by restarting")
+				continue
+			}
+			if err := app.disableModule(e); err != nil {
+				app.Log.Warn(strings.Join(zerror.UnwrapErrors(err), ": "))
+			}
+		}
+	}
+
+	for _, e := range entries {
+		if !e.active.Load() && app.Conf.moduleEnabled(e.name) {
+			if isCriticalModule(e.mod) {
+				app.Log.Warn(e.name + " module: critical module can only be enabled by restarting")
+				continue
+			}
+			if err := app.enableModule(web, e); err != nil {
+				app.Log.Warn(strings.Join(zerror.UnwrapErrors(err), ": "))
+			}
+		}
+	}
+}
+
+// enableModule loads, starts and mounts a module that is not running.
+func (app *App) enableModule(web *Web, e *moduleEntry) error {
+	r := app.registry()
+	for _, dep := range e.deps {
+		d := r.get(dep)
+		if d == nil || !d.active.Load() {
+			return errors.New(e.name + " module: dependency " + dep + " is not enabled")
+		}
+	}
+
+	if err := checkManifests([]*moduleEntry{e}, r.activeEntries()); err != nil {
+		return err
+	}
+
+	if err := app.loadEntry(e); err != nil {
+		return err
+	}
+
+	if err := app.startSequential([]*moduleEntry{e}); err != nil {
+		return err
+	}
+
+	if err := app.runEntry(web, e); err != nil {
+		if r.removeStarted(e) {
+			_ = stopModule(app, e)
+		}
+		return err
+	}
+
+	app.printLog("Module", "enabled "+e.name)
+	return nil
+}
+
+// disableModule stops a running module, its routes answer not found until it is enabled again.
+func (app *App) disableModule(e *moduleEntry) error {
+	for _, d := range app.registry().all() {
+		if !d.active.Load() {
+			continue
+		}
+		for _, dep := range d.deps {
+			if dep == e.name {
+				return errors.New(e.name + " module: required by enabled module " + d.name)
+			}
+		}
+		if m, ok := d.mod.(ModuleManifester); ok {
+			if _, ok := m.Manifest().Requires[e.name]; ok {
+				return errors.New(e.name + " module: required by enabled module " + d.name)
+			}
+		}
+	}
+
+	e.active.Store(false)
+	if !app.registry().removeStarted(e) {
+		return nil
+	}
+
+	if err := stopModule(app, e); err != nil {
+		return err
+	}
+	e.setState(ModuleDisabled)
+
+	app.printLog("Module", "disabled "+e.name)
+	return nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sohaha/zlsgo/zerror"
+)
+
+// Lifecycle phases carried by a ModuleEvent.
+const (
+	PhaseLoad   = "load"
+	PhaseStart  = "start"
+	PhaseDone   = "done"
+	PhaseReload = "reload"
+	PhaseStop   = "stop"
+)
+
+type (
+	// ModuleEvent is published after a module went through a lifecycle phase.
+	ModuleEvent struct {
+		// Err is the error returned by the phase, nil on success.
+		Err      error
+		Module   string
+		Phase    string
+		Duration time.Duration
+	}
+
+	// eventBus delivers the events to the subscribers in subscription order.
+	eventBus struct {
+		subs map[uint64]func(interface{})
+		seq  uint64
+		mu   sync.RWMutex
+	}
+)
+
+var eventsMu sync.Mutex
+
+func (app *App) events() *eventBus {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if app.bus == nil {
+		app.bus = &eventBus{subs: make(map[uint64]func(interface{}))}
+	}
+	return app.bus
+}
+
+// Subscribe calls fn after every lifecycle phase of every module, until unsubscribe is called.
+// fn runs synchronously on the lifecycle path, it should return quickly.
+func (app *App) Subscribe(fn func(ModuleEvent)) (unsubscribe func()) {
+	return app.subscribe(func(ev interface{}) {
+		if e, ok := ev.(ModuleEvent); ok {
+			fn(e)
+		}
+	})
+}
+
+func (app *App) subscribe(fn func(interface{})) (unsubscribe func()) {
+	b := app.events()
+	b.mu.Lock()
+	b.seq++
+	id := b.seq
+	b.subs[id] = fn
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// publish delivers the event, a panicking subscriber is logged and does not affect the others.
+func (app *App) publish(ev interface{}) {
+	b := app.events()
+	b.mu.RLock()
+	ids := make([]uint64, 0, len(b.subs))
+	for id := range b.subs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	subs := make([]func(interface{}), 0, len(ids))
+	for _, id := range ids {
+		subs = append(subs, b.subs[id])
+	}
+	b.mu.RUnlock()
+
+	for _, fn := range subs {
+		err := zerror.TryCatch(func() error {
+			fn(ev)
+			return nil
+		})
+		if err != nil && app.Log != nil {
+			app.Log.Error("module event subscriber: " + err.Error())
+		}
+	}
+}
+
+// record stores the outcome of a lifecycle phase of the module and publishes it.
+func (app *App) record(e *moduleEntry, phase string, state ModuleState, took time.Duration, err error) {
+	e.record(phase, state, took, err)
+	app.publish(ModuleEvent{Module: e.name, Phase: phase, Duration: took, Err: err})
+}
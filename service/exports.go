@@ -0,0 +1,175 @@
+package service
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/sohaha/zlsgo/zdi"
+)
+
+type (
+	// moduleExports holds the values shared by the modules, the application injector resolves them
+	// before its own values and its parent. Every value is recorded with the module that shared it,
+	// so the values of a module can be removed and the value shared before by another module of the
+	// same type is resolved again.
+	moduleExports struct {
+		root     zdi.Injector
+		registry *moduleRegistry // registry holds the named and collection bindings.
+		values   map[reflect.Type][]*exportedValue
+		seq      uint64
+		mu       sync.Mutex
+	}
+
+	exportedValue struct {
+		value reflect.Value
+		lazy  *lazyProvider
+		owner string
+		seq   uint64 // seq is the export order, the latest export wins.
+	}
+
+	// lazyProvider is a provider function called on the first resolution of one of its types.
+	lazyProvider struct {
+		fn      reflect.Value
+		results []reflect.Value
+		once    sync.Once
+	}
+)
+
+// exports returns the values shared by the modules, they are created on first use.
+// The application injector keeps its parent, the shared values are resolved in front of it.
+func (app *App) exports() *moduleExports {
+	root := app.rootInjector()
+	if root == nil {
+		return nil
+	}
+
+	r := app.registry()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.exports == nil {
+		r.exports = &moduleExports{root: root, registry: r, values: make(map[reflect.Type][]*exportedValue)}
+	}
+	return r.exports
+}
+
+// rootInjector returns the application injector without the lock of the module scopes.
+func (app *App) rootInjector() zdi.Injector {
+	di := app.DI
+	if s, ok := di.(*moduleScope); ok {
+		di = s.parent
+	}
+	if l, ok := di.(*lockedInjector); ok {
+		return l.Injector
+	}
+	inj, _ := di.(zdi.Injector)
+	return inj
+}
+
+// set shares the value under t for the owner, it takes precedence over the values shared before
+// and replaces the value of t shared before by the same owner.
+func (x *moduleExports) set(owner string, t reflect.Type, v reflect.Value) {
+	x.mu.Lock()
+	x.add(t, &exportedValue{owner: owner, value: v})
+	x.mu.Unlock()
+}
+
+// provide shares the types returned by the provider function for the owner.
+func (x *moduleExports) provide(owner string, provider reflect.Value) {
+	lazy := &lazyProvider{fn: provider}
+	x.mu.Lock()
+	for _, t := range provideTypes(provider) {
+		x.add(t, &exportedValue{owner: owner, lazy: lazy})
+	}
+	x.mu.Unlock()
+}
+
+// add records v as the latest value of t, x.mu must be held.
+func (x *moduleExports) add(t reflect.Type, v *exportedValue) {
+	values := x.values[t]
+	kept := values[:0]
+	for _, e := range values {
+		if e.owner != v.owner {
+			kept = append(kept, e)
+		}
+	}
+	x.seq++
+	v.seq = x.seq
+	x.values[t] = append(kept, v)
+}
+
+// remove drops the values shared by the owner.
+func (x *moduleExports) remove(owner string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for t, values := range x.values {
+		kept := values[:0]
+		for _, v := range values {
+			if v.owner != owner {
+				kept = append(kept, v)
+			}
+		}
+		if len(kept) == 0 {
+			delete(x.values, t)
+		} else {
+			x.values[t] = kept
+		}
+	}
+}
+
+// owner returns the module that shared the value resolved for t.
+func (x *moduleExports) owner(t reflect.Type) (string, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	values := x.values[t]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1].owner, true
+}
+
+// lookup returns the value shared for t, an interface resolves to the latest value implementing it.
+func (x *moduleExports) lookup(t reflect.Type) *exportedValue {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if values := x.values[t]; len(values) > 0 {
+		return values[len(values)-1]
+	}
+
+	var latest *exportedValue
+	if t.Kind() == reflect.Interface {
+		for k, values := range x.values {
+			if len(values) == 0 || !k.Implements(t) {
+				continue
+			}
+			if v := values[len(values)-1]; latest == nil || v.seq > latest.seq {
+				latest = v
+			}
+		}
+	}
+	return latest
+}
+
+// get resolves t from the values shared by the modules and their bindings, a provider is called
+// outside of the lock with its arguments resolved from the application injector.
+func (x *moduleExports) get(t reflect.Type) (reflect.Value, bool) {
+	if v := x.lookup(t); v != nil {
+		if v.lazy == nil {
+			return v.value, true
+		}
+		v.lazy.once.Do(func() {
+			di := &lockedInjector{Injector: x.root, exports: x, mu: &x.registry.di}
+			results, err := di.Invoke(v.lazy.fn.Interface())
+			if err != nil {
+				panic(err)
+			}
+			v.lazy.results = results
+		})
+		for _, r := range v.lazy.results {
+			if r.Type() == t || (t.Kind() == reflect.Interface && r.Type().Implements(t)) {
+				return r, true
+			}
+		}
+	}
+	return x.registry.collect(t)
+}
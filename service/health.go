@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sohaha/zlsgo/zerror"
+	"github.com/sohaha/zlsgo/znet"
+	"github.com/sohaha/zlsgo/ztype"
+)
+
+type (
+	// ModuleHealth is implemented by modules that can report whether they are alive.
+	ModuleHealth interface {
+		Health(ctx context.Context) error
+	}
+
+	// ModuleReady is implemented by modules that can report whether they can serve traffic.
+	ModuleReady interface {
+		Ready(ctx context.Context) error
+	}
+
+	// ModuleStatus is the result of a health or readiness check of a module.
+	ModuleStatus struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+)
+
+var (
+	// HealthPath is the route of the liveness probe, empty disables it.
+	HealthPath = "/healthz"
+
+	// ReadyPath is the route of the readiness probe, empty disables it.
+	ReadyPath = "/readyz"
+
+	// ProbeTimeout is the maximum time given to the module checks of a probe.
+	ProbeTimeout = 5 * time.Second
+)
+
+const (
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// Health runs the Health check of every started module.
+func (app *App) Health(ctx context.Context) (map[string]ModuleStatus, error) {
+	return checkModules(ctx, app.registry().startedModules(), func(mod Module, ctx context.Context) error {
+		if h, ok := mod.(ModuleHealth); ok {
+			return h.Health(ctx)
+		}
+		return nil
+	})
+}
+
+// Ready runs the Ready check of every started module,
+// the application is not ready until all modules have been initialized.
+func (app *App) Ready(ctx context.Context) (map[string]ModuleStatus, error) {
+	r := app.registry()
+	result, err := checkModules(ctx, r.startedModules(), func(mod Module, ctx context.Context) error {
+		if h, ok := mod.(ModuleReady); ok {
+			return h.Ready(ctx)
+		}
+		return nil
+	})
+	if err == nil && !r.isReady() {
+		err = errors.New("modules are not initialized")
+	}
+	return result, err
+}
+
+func checkModules(ctx context.Context, entries []*moduleEntry, check func(Module, context.Context) error) (map[string]ModuleStatus, error) {
+	type checked struct {
+		err  error
+		name string
+	}
+
+	ch := make(chan checked, len(entries))
+	for _, e := range entries {
+		e := e
+		go func() {
+			ch <- checked{name: e.name, err: zerror.TryCatch(func() error { return check(e.mod, ctx) })}
+		}()
+	}
+
+	result := make(map[string]ModuleStatus, len(entries))
+	for range entries {
+		select {
+		case c := <-ch:
+			result[c.name] = newModuleStatus(c.err)
+		case <-ctx.Done():
+			for _, e := range entries {
+				if _, ok := result[e.name]; !ok {
+					result[e.name] = newModuleStatus(ctx.Err())
+				}
+			}
+		}
+		if len(result) == len(entries) {
+			break
+		}
+	}
+
+	failed := make([]string, 0)
+	for _, e := range entries {
+		if result[e.name].Status != statusOK {
+			failed = append(failed, e.name)
+		}
+	}
+	if len(failed) > 0 {
+		return result, errors.New("unhealthy modules: " + strings.Join(failed, ", "))
+	}
+	return result, nil
+}
+
+func newModuleStatus(err error) ModuleStatus {
+	if err == nil {
+		return ModuleStatus{Status: statusOK}
+	}
+	return ModuleStatus{Status: statusError, Error: strings.Join(zerror.UnwrapErrors(err), ": ")}
+}
+
+// probeHandler renders the result of a probe, responding 503 when any check fails.
+func probeHandler(probe func(ctx context.Context) (map[string]ModuleStatus, error)) znet.Handler {
+	return func(c *znet.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), ProbeTimeout)
+		defer cancel()
+
+		modules, err := probe(ctx)
+		data := ztype.Map{
+			"status":  statusOK,
+			"modules": modules,
+		}
+		if err != nil {
+			data["status"] = statusError
+			data["error"] = err.Error()
+			c.JSON(http.StatusServiceUnavailable, data)
+			return
+		}
+		c.JSON(http.StatusOK, data)
+	}
+}
+
+// registerStatusRoutes mounts the liveness, readiness and module report routes.
+func registerStatusRoutes(r *znet.Engine, app *App) {
+	if HealthPath != "" {
+		r.GET(HealthPath, probeHandler(app.Health))
+	}
+	if ReadyPath != "" {
+		r.GET(ReadyPath, probeHandler(app.Ready))
+	}
+	if ModulesPath != "" {
+		r.GET(ModulesPath, modulesHandler(app))
+	}
+	if ConfPath != "" {
+		r.GET(ConfPath, confHandler(app))
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sohaha/zlsgo/znet"
+)
+
+type testProbeModule struct {
+	testModule
+	health error
+	ready  error
+}
+
+func (m *testProbeModule) Health(context.Context) error {
+	return m.health
+}
+
+func (m *testProbeModule) Ready(context.Context) error {
+	return m.ready
+}
+
+func TestStatusRoutes(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	r := znet.New()
+	r.SetMode(znet.ProdMode)
+	registerStatusRoutes(r, app)
+
+	probe := func(path string) (int, map[string]interface{}) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var data map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+			t.Fatalf("%s: %v %q", path, err, w.Body.String())
+		}
+		return w.Code, data
+	}
+
+	if code, data := probe(ReadyPath); code != http.StatusServiceUnavailable || data["status"] != statusError {
+		t.Fatalf("expected not ready before the modules are initialized, got %d %v", code, data)
+	}
+
+	ok := &testProbeModule{testModule: testModule{name: "ok"}}
+	failing := &testProbeModule{testModule: testModule{name: "failing"}, ready: errors.New("warming up")}
+	if err := InitModule([]Module{ok, failing}, app); err != nil {
+		t.Fatal(err)
+	}
+
+	code, data := probe(HealthPath)
+	if code != http.StatusOK || data["status"] != statusOK {
+		t.Fatalf("expected healthy, got %d %v", code, data)
+	}
+	if modules, _ := data["modules"].(map[string]interface{}); len(modules) != 2 {
+		t.Fatalf("expected the status of both modules, got %v", data["modules"])
+	}
+
+	code, data = probe(ReadyPath)
+	modules, _ := data["modules"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || data["status"] != statusError || data["error"] != "unhealthy modules: failing" {
+		t.Fatalf("expected not ready, got %d %v", code, data)
+	}
+	if s, _ := modules["failing"].(map[string]interface{}); s["status"] != statusError || s["error"] != "warming up" {
+		t.Fatalf("unexpected status of failing: %v", modules["failing"])
+	}
+	if s, _ := modules["ok"].(map[string]interface{}); s["status"] != statusOK {
+		t.Fatalf("unexpected status of ok: %v", modules["ok"])
+	}
+
+	failing.ready = nil
+	if code, data = probe(ReadyPath); code != http.StatusOK {
+		t.Fatalf("expected ready, got %d %v", code, data)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/sohaha/zlsgo/zdi"
+)
+
+// lockedInjector is the application injector as seen by the App and the module scopes, it serializes
+// the access to the injector so modules started in parallel can resolve values and export them at the same time.
+// The values shared by the modules are resolved first, then the injector and its parent.
+// Providers are called outside of the lock, functions are invoked outside of it and their arguments are resolved through it.
+type lockedInjector struct {
+	zdi.Injector
+	exports *moduleExports
+	mu      *sync.Mutex
+}
+
+func (l *lockedInjector) Get(t reflect.Type) (reflect.Value, bool) {
+	if l.exports != nil {
+		if v, ok := l.exports.get(t); ok {
+			return v, true
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Injector.Get(t)
+}
+
+func (l *lockedInjector) Set(t reflect.Type, v reflect.Value) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Injector.Set(t, v)
+}
+
+func (l *lockedInjector) Map(val interface{}, opt ...zdi.Option) reflect.Type {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Injector.Map(val, opt...)
+}
+
+func (l *lockedInjector) Maps(values ...interface{}) []reflect.Type {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Injector.Maps(values...)
+}
+
+// Provide shares the provider like the values of the modules, so its arguments are resolved through the shared values.
+// A provider with options is provided by the injector itself.
+func (l *lockedInjector) Provide(provider interface{}, opt ...zdi.Option) []reflect.Type {
+	if l.exports != nil && len(opt) == 0 {
+		if v := reflect.ValueOf(provider); v.Kind() == reflect.Func {
+			l.exports.provide("", v)
+			return nil
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Injector.Provide(provider, opt...)
+}
+
+func (l *lockedInjector) SetParent(parent zdi.Injector) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Injector.SetParent(parent)
+}
+
+func (l *lockedInjector) Resolve(v ...zdi.Pointer) error {
+	return zdi.New(l).Resolve(v...)
+}
+
+func (l *lockedInjector) Apply(p zdi.Pointer) error {
+	return zdi.New(l).Apply(p)
+}
+
+func (l *lockedInjector) Invoke(f interface{}) ([]reflect.Value, error) {
+	return zdi.New(l).Invoke(f)
+}
+
+func (l *lockedInjector) InvokeWithErrorOnly(f interface{}) error {
+	return zdi.New(l).InvokeWithErrorOnly(f)
+}
+
+// sharedInjector returns the application injector as seen by the module scopes, NewApp installs it as App.DI.
+func (app *App) sharedInjector() zdi.Injector {
+	if s, ok := app.DI.(*moduleScope); ok {
+		return s.parent
+	}
+	if l, ok := app.DI.(*lockedInjector); ok {
+		return l
+	}
+	return &lockedInjector{Injector: app.DI.(zdi.Injector), exports: app.exports(), mu: &app.registry().di}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sohaha/zlsgo/zerror"
+	"github.com/sohaha/zlsgo/znet"
+)
+
+// ModuleState is the lifecycle state of a module.
+type ModuleState string
+
+const (
+	ModuleRegistered ModuleState = "registered"
+	ModuleDisabled   ModuleState = "disabled"
+	ModuleLoaded     ModuleState = "loaded"
+	ModuleStarted    ModuleState = "started"
+	ModuleDone       ModuleState = "done"
+	ModuleStopped    ModuleState = "stopped"
+	ModuleFailed     ModuleState = "failed"
+)
+
+// ModuleInfo describes what InitModule did with a module.
+type ModuleInfo struct {
+	Timings     map[string]time.Duration `json:"timings"`
+	Name        string                   `json:"name"`
+	Type        string                   `json:"type"`
+	State       ModuleState              `json:"state"`
+	Error       string                   `json:"error,omitempty"`
+	DependsOn   []string                 `json:"depends_on,omitempty"`
+	Tasks       []string                 `json:"tasks,omitempty"`
+	Controllers []string                 `json:"controllers,omitempty"`
+	Provides    []string                 `json:"provides,omitempty"`
+}
+
+// ModulesPath is the route of the JSON module report, empty disables it.
+var ModulesPath = ""
+
+// record stores the outcome of a lifecycle phase of the module.
+func (e *moduleEntry) record(phase string, state ModuleState, took time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.info.Timings[phase] = took
+	if err != nil {
+		e.info.State = ModuleFailed
+		e.info.Error = strings.Join(zerror.UnwrapErrors(err), ": ")
+		return
+	}
+	e.info.State = state
+	e.info.Error = ""
+}
+
+func (e *moduleEntry) setState(state ModuleState) {
+	e.mu.Lock()
+	e.info.State = state
+	e.mu.Unlock()
+}
+
+// setContributions stores the tasks and controllers the module contributed.
+func (e *moduleEntry) setContributions(tasks []Task, controllers []Controller) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.info.Tasks = make([]string, 0, len(tasks))
+	for i := range tasks {
+		e.info.Tasks = append(e.info.Tasks, tasks[i].Name+" ["+tasks[i].Cron+"]")
+	}
+
+	e.info.Controllers = make([]string, 0, len(controllers))
+	for i := range controllers {
+		if controllers[i] == nil {
+			continue
+		}
+		e.info.Controllers = append(e.info.Controllers, reflect.TypeOf(controllers[i]).String())
+	}
+}
+
+func (e *moduleEntry) setProvides(types []string) {
+	e.mu.Lock()
+	e.info.Provides = types
+	e.mu.Unlock()
+}
+
+func (e *moduleEntry) snapshot() ModuleInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	info := e.info
+	info.Timings = make(map[string]time.Duration, len(e.info.Timings))
+	for k, v := range e.info.Timings {
+		info.Timings[k] = v
+	}
+	return info
+}
+
+// providedBy returns the names of the types provided by the module.
+func (r *moduleRegistry) providedBy(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0)
+	for t, owner := range r.providers {
+		if owner == name {
+			types = append(types, t.String())
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Modules returns the registered modules in registration order.
+func (app *App) Modules() []ModuleInfo {
+	entries := app.registry().all()
+	infos := make([]ModuleInfo, 0, len(entries))
+	for _, e := range entries {
+		infos = append(infos, e.snapshot())
+	}
+	return infos
+}
+
+// modulesHandler renders the module report.
+func modulesHandler(app *App) znet.Handler {
+	return func(c *znet.Context) {
+		c.JSON(http.StatusOK, app.Modules())
+	}
+}
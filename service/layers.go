@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sohaha/zlsgo/zfile"
+	"github.com/spf13/viper"
+)
+
+var (
+	// ConfEnvKey is the environment variable selecting the environment-specific config file,
+	// <AppName>_ENV is checked before it.
+	ConfEnvKey = "APP_ENV"
+
+	// ConfEnv is the default environment when no environment variable selects one.
+	ConfEnv = "dev"
+
+	// ConfArgs are the command-line arguments searched for --config, --set and --print-config, nil disables the flags.
+	// With --print-config InitModule prints the effective configuration and returns ErrConfPrinted.
+	// Set it to os.Args[1:] to read them from the command line.
+	ConfArgs []string
+)
+
+type (
+	// confLayer is a config file merged over the base config file.
+	confLayer struct {
+		data map[string]interface{}
+		good map[string]interface{}
+		file string
+	}
+
+	// confFlags are the configuration flags of the command line.
+	confFlags struct {
+		file  string
+		sets  [][2]string
+		print bool
+	}
+)
+
+// read reads the file of the layer, a missing file is an empty layer.
+func (l *confLayer) read() error {
+	if !zfile.FileExist(l.file) {
+		l.data = nil
+		return nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(l.file)
+	if err := v.ReadInConfig(); err != nil {
+		return errors.New(l.file + ": " + err.Error())
+	}
+	l.data = v.AllSettings()
+	return nil
+}
+
+// confEnv returns the selected environment.
+func confEnv() string {
+	for _, key := range []string{strings.ToUpper(AppName) + "_ENV", ConfEnvKey} {
+		if env := strings.TrimSpace(os.Getenv(key)); env != "" {
+			return env
+		}
+	}
+	return ConfEnv
+}
+
+// parseConfFlags reads --config path, the repeatable --set key=value, both also in the --flag=value form,
+// and --print-config, other arguments are left to the application.
+func parseConfFlags(args []string) (f confFlags, err error) {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			break
+		}
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+		name, value, hasValue := args[i][2:], "", false
+		if j := strings.IndexByte(name, '='); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		if name == "print-config" && !hasValue {
+			f.print = true
+			continue
+		}
+		if name != "config" && name != "set" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return f, errors.New("flag needs an argument: --" + name)
+			}
+			i++
+			value = args[i]
+		}
+
+		if name == "config" {
+			f.file = value
+			continue
+		}
+		kv := strings.SplitN(value, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) != 2 || key == "" {
+			return f, errors.New("invalid --set " + value + ", expected key=value")
+		}
+		f.sets = append(f.sets, [2]string{key, kv[1]})
+	}
+	return
+}
+
+// layerFiles returns the environment-specific and the local config file next to the base config file.
+func layerFiles(base, env string) []string {
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	files := make([]string, 0, 2)
+	if env != "" {
+		files = append(files, name+"-"+env+ext)
+	}
+	return append(files, name+".local"+ext)
+}
+
+// read reads the base config file and merges the layers over it.
+func (c *Conf) read() error {
+	if err := c.cfg.Read(); err != nil {
+		return err
+	}
+	for _, l := range c.layers {
+		if err := l.read(); err != nil {
+			return err
+		}
+		if l.data != nil {
+			_ = c.cfg.Core.MergeConfigMap(l.data)
+		}
+	}
+	return c.resolve()
+}
+
+// Env returns the environment that selected the environment-specific config file.
+func (c *Conf) Env() string {
+	return c.env
+}
+
+// Files returns the config files in effect, from the lowest to the highest precedence.
+func (c *Conf) Files() []string {
+	files := make([]string, 0, len(c.layers)+1)
+	if file := c.cfg.Core.ConfigFileUsed(); file != "" && zfile.FileExist(file) {
+		files = append(files, file)
+	}
+	for _, l := range c.layers {
+		if l.data != nil {
+			files = append(files, l.file)
+		}
+	}
+	return files
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/zerror"
+	"github.com/sohaha/zlsgo/znet"
+)
+
+// loadEntry runs the Load phase of the module.
+func (app *App) loadEntry(e *moduleEntry) error {
+	if e.loaded {
+		return nil
+	}
+	if err := app.bindModuleConf(e); err != nil {
+		app.record(e, PhaseLoad, ModuleLoaded, 0, err)
+		return err
+	}
+
+	t := time.Now()
+	err := loadModule(app, e.invoker(app), e.name, e.mod)
+	app.record(e, PhaseLoad, ModuleLoaded, time.Since(t), err)
+	if err != nil {
+		return err
+	}
+	e.setProvides(app.registry().providedBy(e.name))
+	e.loaded = true
+	return nil
+}
+
+// startEntry runs the Start phase of the module.
+func (app *App) startEntry(e *moduleEntry) error {
+	t := time.Now()
+	err := zerror.TryCatch(func() error { return e.mod.Start(e.invoker(app)) })
+	app.record(e, PhaseStart, ModuleStarted, time.Since(t), err)
+	if err != nil {
+		return zerror.With(err, e.name+" module: failed to Start")
+	}
+	app.registry().markStarted(e)
+	return nil
+}
+
+// runEntry schedules the tasks of the module, mounts its controllers and runs the Done phase.
+func (app *App) runEntry(web *Web, e *moduleEntry) (err error) {
+	t := time.Now()
+	defer func() {
+		app.record(e, PhaseDone, ModuleDone, time.Since(t), err)
+	}()
+
+	tasks, controllers := e.mod.Tasks(), e.mod.Controller()
+	e.setContributions(tasks, controllers)
+
+	if e.cron, err = initTask(&tasks, app); err != nil {
+		return zerror.With(err, e.name+" module: timed task launch failed")
+	}
+
+	if r := app.registry(); web != nil && len(controllers) > 0 && !e.mounted {
+		for i := range controllers {
+			if err = assignModuleConf(reflect.ValueOf(controllers[i]), e.config); err != nil {
+				return zerror.With(err, e.name+" module: init router failed")
+			}
+		}
+		scoped := *app
+		scoped.DI = e.invoker(app)
+		// The routes of the Web can not change while it serves and the ones of a module unregistered
+		// before stay bound on it, the routes go to a router of the module.
+		target, router := web, (*znet.Engine)(nil)
+		if r.isServing() || r.isMounted(e.name) {
+			target = newModuleRouter(web)
+			router = target.Engine
+		}
+		if err = initRouter(&scoped, target, controllers, moduleGuard(web, app, e)); err != nil {
+			return zerror.With(err, e.name+" module: init router failed")
+		}
+		r.setMounted(e, router)
+	}
+
+	if err = zerror.TryCatch(func() error { return e.mod.Done(e.invoker(app)) }); err != nil {
+		return zerror.With(err, e.name+" module: failed to Done")
+	}
+
+	e.active.Store(true)
+
+	reload := e.vof.MethodByName("Reload")
+	if !e.reloadable && reload.IsValid() && reload.Type().Kind() == reflect.Func {
+		e.reloadable = true
+		f, key := reload.Interface(), ""
+		if e.config != nil {
+			key = e.config.key
+		}
+		hook := reloadHook{key: key, fn: func(ch ConfChange) error {
+			if !e.active.Load() {
+				return nil
+			}
+			t := time.Now()
+			err := e.invokeReload(app, f, ch)
+			app.publish(ModuleEvent{Module: e.name, Phase: PhaseReload, Duration: time.Since(t), Err: err})
+			if err != nil {
+				return zerror.With(err, e.name+" failed to Reload")
+			}
+			return nil
+		}}
+		if prepare := e.vof.MethodByName("PrepareReload"); prepare.IsValid() {
+			p := prepare.Interface()
+			hook.prepare = func(ch ConfChange) error {
+				if !e.active.Load() {
+					return nil
+				}
+				if err := e.invokeReload(app, p, ch); err != nil {
+					return zerror.With(err, e.name+" refused to Reload")
+				}
+				return nil
+			}
+		}
+		app.Conf.reloads = append(app.Conf.reloads, hook)
+	}
+
+	return nil
+}
+
+// invokeReload calls a Reload or PrepareReload method of the module with the change
+// and the module injector.
+func (e *moduleEntry) invokeReload(app *App, fn interface{}, ch ConfChange) error {
+	di := zdi.New(e.invoker(app).(zdi.Injector))
+	_ = di.Map(ch)
+	_ = di.Map(di, zdi.WithInterface((*zdi.Invoker)(nil)))
+	return di.InvokeWithErrorOnly(fn)
+}
+
+// moduleGuard answers not found for the routes of the module while it is not active or no longer registered,
+// the not found path dispatches the request to the routes of a module registered again under the name.
+func moduleGuard(web *Web, app *App, e *moduleEntry) znet.Handler {
+	r := app.registry()
+	return func(c *znet.Context) {
+		if r.get(e.name) != e || !e.active.Load() {
+			web.HandleNotFound(c, true)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// ModuleManifest describes a module and what it needs to run.
+	ModuleManifest struct {
+		// ConfigSchema describes the configuration section of the module,
+		// it is derived from ModuleConfig when empty.
+		ConfigSchema any `json:"config_schema,omitempty"`
+		// Requires maps the name of the modules needed to the version range they must match.
+		Requires map[string]string `json:"requires,omitempty"`
+		// Name is filled with the module name.
+		Name        string `json:"name"`
+		Version     string `json:"version,omitempty"`
+		Description string `json:"description,omitempty"`
+		// AppCore is the version range of app_core the module works with.
+		AppCore string `json:"app_core,omitempty"`
+	}
+
+	// ModuleManifester is implemented by modules that expose a manifest.
+	ModuleManifester interface {
+		Manifest() ModuleManifest
+	}
+)
+
+// moduleManifest returns the manifest of the module, modules without one get a bare manifest.
+func moduleManifest(e *moduleEntry) ModuleManifest {
+	var m ModuleManifest
+	if mm, ok := e.mod.(ModuleManifester); ok {
+		m = mm.Manifest()
+	}
+	m.Name = e.name
+
+	if m.ConfigSchema == nil {
+		var conf any
+		if e.config != nil {
+			conf = e.config.defaults.Interface()
+		} else if mc, ok := e.mod.(ModuleConfig); ok {
+			conf = mc.Config()
+		}
+		if conf != nil {
+			m.ConfigSchema = configSchema(reflect.ValueOf(conf))
+		}
+	}
+	return m
+}
+
+// checkManifests refuses the modules whose manifest is not satisfied by app_core or by the other modules.
+func checkManifests(entries []*moduleEntry, running map[string]*moduleEntry) error {
+	var errs ModuleErrors
+	for _, e := range entries {
+		mm, ok := e.mod.(ModuleManifester)
+		if !ok {
+			continue
+		}
+		m := mm.Manifest()
+
+		if m.Version != "" {
+			if _, err := parseVersion(m.Version); err != nil {
+				errs = append(errs, errors.New(e.name+" module: "+err.Error()))
+			}
+		}
+
+		if m.AppCore != "" && Version != "" {
+			if ok, err := matchVersion(Version, m.AppCore); err != nil || !ok {
+				errs = append(errs, versionError(e.name, "app_core", Version, m.AppCore, err))
+			}
+		}
+
+		names := make([]string, 0, len(m.Requires))
+		for name := range m.Requires {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			dep, ok := running[name]
+			if !ok {
+				errs = append(errs, errors.New(e.name+" module: requires module "+name))
+				continue
+			}
+			var version string
+			if dm, ok := dep.mod.(ModuleManifester); ok {
+				version = dm.Manifest().Version
+			}
+			if version == "" {
+				errs = append(errs, errors.New(e.name+" module: requires "+name+" "+m.Requires[name]+", but it has no version"))
+				continue
+			}
+			if ok, err := matchVersion(version, m.Requires[name]); err != nil || !ok {
+				errs = append(errs, versionError(e.name, name, version, m.Requires[name], err))
+			}
+		}
+	}
+	return errs.Err()
+}
+
+func versionError(name, dep, version, constraint string, err error) error {
+	if err != nil {
+		return errors.New(name + " module: " + dep + " " + constraint + ": " + err.Error())
+	}
+	return errors.New(name + " module: requires " + dep + " " + constraint + ", got " + version)
+}
+
+// Manifests returns the manifests of the registered modules in registration order.
+func (app *App) Manifests() []ModuleManifest {
+	entries := app.registry().all()
+	manifests := make([]ModuleManifest, 0, len(entries))
+	for _, e := range entries {
+		manifests = append(manifests, moduleManifest(e))
+	}
+	return manifests
+}
+
+// PrintManifests writes the app_core version and the manifests of the registered modules as JSON.
+func (app *App) PrintManifests(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(struct {
+		AppCore string           `json:"app_core"`
+		Modules []ModuleManifest `json:"modules"`
+	}{
+		AppCore: Version,
+		Modules: app.Manifests(),
+	})
+}
+
+// configSchema describes the fields of a config struct with their type and default value.
+func configSchema(v reflect.Value) map[string]any {
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		props := make(map[string]any)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("z"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = configSchema(v.Field(i))
+		}
+		return map[string]any{"type": "object", "properties": props}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": configSchema(reflect.New(v.Type().Elem()).Elem()), "default": v.Interface()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "default": v.Interface()}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean", "default": v.Interface()}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "default": v.Interface()}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "default": v.Interface()}
+	case reflect.String:
+		return map[string]any{"type": "string", "default": v.Interface()}
+	}
+	return map[string]any{}
+}
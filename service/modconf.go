@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/zreflect"
+	"github.com/sohaha/zlsgo/ztype"
+)
+
+// ModuleConfig is implemented by modules that own a configuration section.
+// Config returns a pointer to a struct holding the default values,
+// it is registered as a default under the module name (or its ConfKey),
+// filled from the configuration before Load, refilled on hot reload,
+// mapped into the module injector and assigned to the fields of the module controllers of the same type.
+type ModuleConfig interface {
+	Config() any
+}
+
+// moduleConf is the configuration section bound to a module.
+type moduleConf struct {
+	value    reflect.Value
+	defaults reflect.Value
+	key      string
+}
+
+// bindModuleConf registers the configuration section of the module and fills it.
+func (app *App) bindModuleConf(e *moduleEntry) error {
+	if e.config != nil {
+		return nil
+	}
+	mc, ok := e.mod.(ModuleConfig)
+	if !ok {
+		return nil
+	}
+	raw := mc.Config()
+	if raw == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(raw)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New(e.name + " module: Config must return a pointer to a struct")
+	}
+
+	key, isVar := getConfName(v)
+	if !isVar {
+		key = e.name
+	}
+
+	defaults := reflect.New(v.Elem().Type()).Elem()
+	defaults.Set(v.Elem())
+	c := &moduleConf{key: strings.ToLower(key), value: v, defaults: defaults}
+
+	if app.Conf != nil && app.Conf.cfg != nil {
+		// A plain map keeps the nested defaults visible when a nested key is overridden.
+		app.Conf.setDefault(c.key, map[string]interface{}(ztype.ToMap(raw)))
+		if err := app.Conf.resolve(); err != nil {
+			return errors.New(e.name + " module: " + err.Error())
+		}
+	}
+	if err := app.fillModuleConf(c); err != nil {
+		return errors.New(e.name + " module: " + err.Error())
+	}
+
+	if e.scope != nil {
+		_ = e.scope.Map(raw)
+	} else {
+		if err := app.claimProviders(e.name, []reflect.Type{v.Type()}); err != nil {
+			return err
+		}
+		_ = app.DI.(zdi.TypeMapper).Map(raw)
+	}
+	e.config = c
+	return nil
+}
+
+// readModuleConf returns a copy of the defaults filled from the current configuration and validated,
+// the error is ValidationErrors.
+func (app *App) readModuleConf(c *moduleConf) (reflect.Value, error) {
+	val := reflect.New(c.defaults.Type())
+	val.Elem().Set(c.defaults)
+	if app.Conf == nil || app.Conf.cfg == nil {
+		return val, nil
+	}
+
+	err := app.Conf.unmarshalKey(c.key, val.Interface())
+	if err == nil {
+		err = ValidateConf(c.key, val.Interface())
+	}
+	if err != nil {
+		return val, violations(c.key, err)
+	}
+	return val, nil
+}
+
+// fillModuleConf fills the section from the defaults and the current configuration.
+func (app *App) fillModuleConf(c *moduleConf) error {
+	val, err := app.readModuleConf(c)
+	if err != nil {
+		return err
+	}
+	c.value.Elem().Set(val.Elem())
+	return nil
+}
+
+// reloadModuleConfs refills the configuration sections of the modules after a change.
+func (app *App) reloadModuleConfs() {
+	for _, e := range app.registry().all() {
+		if e.config == nil {
+			continue
+		}
+		if err := app.fillModuleConf(e.config); err != nil {
+			app.Log.Error(e.name + " module: " + err.Error())
+		}
+	}
+}
+
+// assignModuleConf sets the fields of the controller holding the config type of the module.
+func assignModuleConf(value reflect.Value, c *moduleConf) error {
+	if c == nil || value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	e := value.Elem()
+	t := e.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type != c.value.Type() {
+			continue
+		}
+		if err := zreflect.SetUnexportedField(value, t.Field(i).Name, c.value.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
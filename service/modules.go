@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"reflect"
 	"sort"
 	"strings"
@@ -11,9 +12,6 @@ import (
 	"github.com/sohaha/zlsgo/zlog"
 	"github.com/sohaha/zlsgo/zreflect"
 	"github.com/sohaha/zlsgo/zstring"
-	"github.com/sohaha/zlsgo/zutil"
-
-	"github.com/fsnotify/fsnotify"
 )
 
 type Module interface {
@@ -86,16 +84,6 @@ func (p *ModuleLifeCycle) Stop(di zdi.Invoker) error {
 
 // InitModule initializes the module with the given list of plugins and a dependency injector.
 func InitModule(modules []Module, app *App) (err error) {
-	for _, mod := range modules {
-		value := zreflect.ValueOf(mod)
-		assignApp(value, app)
-		_ = assignDI(value, app.DI)
-		_ = assignConf(value, app.Conf)
-		name := getModuleName(mod, value)
-		_ = assignLog(value, app, "[Module "+name+"] ")
-		_ = app.DI.(zdi.TypeMapper).Map(mod)
-	}
-
 	if _, err := app.DI.Invoke(func([]Module) {}); err != nil {
 		app.DI.(zdi.TypeMapper).Map(modules)
 	}
@@ -108,128 +96,144 @@ func InitModule(modules []Module, app *App) (err error) {
 		_ = app.DI.Resolve(&tasks)
 
 		web, _ := getWeb(app)
+		registry := app.registry()
 
-		moduleTotal := len(modules)
-		runs := make([]func() error, 0, moduleTotal)
-		starts := make([]func() error, 0, moduleTotal)
-
-		type module struct {
-			vof   reflect.Value
-			mod   Module
-			index int
-		}
-
-		modulesMap := make(map[string]module, moduleTotal)
+		modulesMap := make(map[string]*moduleEntry, len(modules))
+		skipped := make([]string, 0)
 		for i := range modules {
 			mod := modules[i]
 			vof := zreflect.ValueOf(mod)
 			name := getModuleName(mod, vof)
-			if _, ok := modulesMap[name]; ok {
+			if _, ok := modulesMap[name]; ok || registry.get(name) != nil {
 				zlog.Warnf("Module %s is already registered. If you need to register multiple identical modules, please use multiple.New(...)", name)
 				continue
 			}
-			modulesMap[name] = module{
-				vof:   vof,
-				index: i,
-				mod:   mod,
+
+			entry := newModuleEntry(name, mod, vof)
+			entry.scope = assignModule(app, mod)
+			registry.add(entry)
+			if !app.Conf.moduleEnabled(name) {
+				entry.setState(ModuleDisabled)
+				skipped = append(skipped, name)
+				continue
+			}
+			modulesMap[name] = entry
+		}
+
+		active := registry.activeEntries()
+		moduleDeps := make(map[string][]string, len(modulesMap))
+		for name, entry := range modulesMap {
+			for _, dep := range entry.deps {
+				if _, ok := active[dep]; ok {
+					continue
+				}
+				if _, ok := modulesMap[dep]; !ok && registry.get(dep) != nil {
+					return errors.New(name + " module: dependency " + dep + " is disabled")
+				}
+				// The running dependencies are already started, only the ones of the batch are ordered.
+				moduleDeps[name] = append(moduleDeps[name], dep)
 			}
 		}
 
 		moduleKeys := zarray.Keys(modulesMap)
 		sort.Strings(moduleKeys)
+		moduleKeys, err := sortModules(moduleKeys, moduleDeps)
+		if err != nil {
+			return err
+		}
+
+		running := active
+		ordered := make([]*moduleEntry, 0, len(moduleKeys))
+		for _, name := range moduleKeys {
+			running[name] = modulesMap[name]
+			ordered = append(ordered, modulesMap[name])
+		}
+		if err := checkManifests(ordered, running); err != nil {
+			return err
+		}
+		if err := app.printConf(ordered); err != nil {
+			return err
+		}
 
 		if len(moduleKeys) > 0 {
 			app.printLog("Module", "["+strings.Join(moduleKeys, ", ")+"]")
 		}
-		for v := range moduleKeys {
-			name := moduleKeys[v]
-			mod, vof := modulesMap[name].mod, modulesMap[name].vof
-			// logname := zlog.ColorTextWrap(zlog.ColorLightGreen, zlog.OpTextWrap(zlog.OpBold, name))
-			// app.printLog("Module Load", logname)
+		if len(skipped) > 0 {
+			sort.Strings(skipped)
+			app.printLog("Skip", "["+strings.Join(skipped, ", ")+"]")
+		}
 
-			if err := loadModule(app.DI.(zdi.Injector), name, mod); err != nil {
+		for _, name := range moduleKeys {
+			if err := app.loadEntry(modulesMap[name]); err != nil {
 				return err
 			}
-
-			starts = append(starts, func() error {
-				// printLog("Module Start", zlog.Log.ColorTextWrap(zlog.ColorLightGreen, name))
-				if err := zerror.TryCatch(func() error { return mod.Start(app.DI) }); err != nil {
-					return zerror.With(err, name+" module: failed to Start")
-				}
-				return nil
-			})
-
-			runs = append(runs, func() error {
-				tasks := mod.Tasks()
-				if err = InitTask(&tasks, app); err != nil {
-					return zerror.With(err, name+" module: timed task launch failed")
-				}
-
-				if web != nil {
-					if err = initRouter(app, web, mod.Controller()); err != nil {
-						return zerror.With(err, name+" module: init router failed")
-					}
-				}
-
-				if err := zerror.TryCatch(func() error { return mod.Done(app.DI) }); err != nil {
-					return zerror.With(err, name+" module: failed to Done")
-				}
-
-				// app.printLog("Module Success", logname)
-
-				reload := vof.MethodByName("Reload")
-				if reload.IsValid() && reload.Type().Kind() == reflect.Func {
-					f := reload.Interface()
-					app.Conf.reloads = append(app.Conf.reloads, func() error {
-						err := app.DI.InvokeWithErrorOnly(f)
-						if err != nil {
-							return zerror.With(err, name+" failed to Reload")
-						}
-						return nil
-					})
-				}
-
-				return nil
-			})
 		}
 
-		for i := range starts {
-			if err := starts[i](); err != nil {
-				return err
+		app.useBoundMiddleware(web)
+
+		if workers := app.Conf.Base.ParallelStart; workers > 1 {
+			if err := app.startParallel(moduleKeys, moduleDeps, modulesMap, workers); err != nil {
+				return rollbackModules(app, ordered, err)
 			}
+		} else if err := app.startSequential(ordered); err != nil {
+			return rollbackModules(app, ordered, err)
 		}
 
-		for i := range runs {
-			if err := runs[i](); err != nil {
-				return err
+		for _, name := range moduleKeys {
+			if err := app.runEntry(web, modulesMap[name]); err != nil {
+				return rollbackModules(app, ordered, err)
 			}
 		}
 
 		if app.Conf.cfg != nil {
-			b := zutil.NewBool(false)
-			app.Conf.cfg.ConfigChange(func(e fsnotify.Event) {
-				if !b.CAS(false, true) {
-					return
-				}
-				if e.Op == fsnotify.Write {
-					app.Conf.autoUnmarshal()
-					for _, fn := range app.Conf.reloads {
-						err = app.DI.InvokeWithErrorOnly(fn)
-						if err != nil {
-							zlog.Error(err)
-						}
-					}
-				}
-				b.Store(false)
-			})
+			app.watchConf(web)
 		}
 
 		fixTask(app)
+		registry.setReady(true)
 
 		return nil
 	})
 }
 
+// assignModule injects the application into the module fields, with the module scope as DI,
+// and maps the module into the application injector.
+func assignModule(app *App, mod Module) *moduleScope {
+	value := zreflect.ValueOf(mod)
+	name := getModuleName(mod, value)
+	scope := newModuleScope(app, name)
+	scoped := *app
+	scoped.DI = scope
+	assignApp(value, &scoped)
+	_ = assignDI(value, scope)
+	_ = assignConf(value, app.Conf)
+	_ = assignLog(value, app, "[Module "+name+"] ")
+	shareValue(scope, value)
+	return scope
+}
+
+// rollbackModules stops the modules of the batch that have already been started, in reverse start order,
+// and returns the error that caused the startup to fail, the stop failures are logged.
+// The modules started before the batch keep running.
+func rollbackModules(app *App, batch []*moduleEntry, err error) error {
+	r := app.registry()
+	started := r.startedModules()
+	var errs ModuleErrors
+	for i := len(started) - 1; i >= 0; i-- {
+		e := started[i]
+		if !zarray.Contains(batch, e) || !r.removeStarted(e) {
+			continue
+		}
+		if stopErr := stopModule(app, e); stopErr != nil {
+			errs = append(errs, stopErr)
+		}
+	}
+	if stopErr := errs.Err(); stopErr != nil {
+		app.Log.Warn("rollback of started modules failed: " + stopErr.Error())
+	}
+	return err
+}
+
 func fixTask(app *App) {
 	var tasks *[]Task
 	if err := app.DI.Resolve(&tasks); err != nil {
@@ -245,7 +249,9 @@ func getModuleName(m Module, val reflect.Value) string {
 	return name
 }
 
-func loadModule(di zdi.Injector, name string, mod Module) error {
+// loadModule runs Load with di, the value it returns is shared through the application injector.
+// Through a module scope the value belongs to the module of the scope, it is removed with that module.
+func loadModule(app *App, di zdi.Invoker, name string, mod Module) error {
 	load, err := mod.Load(di)
 	if err != nil {
 		return zerror.With(err, name+" failed to Load")
@@ -253,11 +259,16 @@ func loadModule(di zdi.Injector, name string, mod Module) error {
 
 	loadVal := zreflect.ValueOf(load)
 	if loadVal.IsValid() {
-		if loadVal.Kind() == reflect.Func {
-			di.Provide(load)
-		} else {
-			di.Map(load)
+		if app != nil {
+			owner := name
+			if s, ok := di.(*moduleScope); ok {
+				owner = s.name
+			}
+			if err = app.claimProviders(owner, provideTypes(loadVal)); err != nil {
+				return zerror.With(err, name+" failed to Load")
+			}
 		}
+		shareValue(di, loadVal)
 	}
 
 	return nil
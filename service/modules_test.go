@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sohaha/zlsgo/zdi"
+)
+
+func TestRollbackOnlyStopsTheBatch(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	var stopped []string
+	newModule := func(name string, startErr error) Module {
+		return &testModule{name: name, ModuleLifeCycle: ModuleLifeCycle{
+			OnStart: func(zdi.Invoker) error { return startErr },
+			OnStop: func(zdi.Invoker) error {
+				stopped = append(stopped, name)
+				return nil
+			},
+		}}
+	}
+
+	if err := InitModule([]Module{newModule("db", nil)}, app); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitModule([]Module{newModule("a", nil), newModule("b", errors.New("failed"))}, app); err == nil {
+		t.Fatal("expected the start failure")
+	}
+
+	if !reflect.DeepEqual(stopped, []string{"a"}) {
+		t.Fatalf("expected only a to be stopped, got %v", stopped)
+	}
+	if e := app.registry().get("db"); e == nil || !e.active.Load() {
+		t.Fatal("expected db to keep running")
+	}
+}
+
+func TestInitModulePrintConf(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	app.Conf.printConf = true
+	loaded := false
+	mod := &testModule{name: "a", ModuleLifeCycle: ModuleLifeCycle{
+		OnLoad: func(zdi.Invoker) (any, error) {
+			loaded = true
+			return nil, nil
+		},
+	}}
+
+	if err := InitModule([]Module{mod}, app); !errors.Is(err, ErrConfPrinted) {
+		t.Fatalf("expected ErrConfPrinted, got %v", err)
+	}
+	if loaded {
+		t.Fatal("expected no module to be loaded")
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/sohaha/zlsgo/zsync"
+	"github.com/sohaha/zlsgo/zutil"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// startContext returns the context the Start of the modules derives from, the one of the application injector if any.
+func (app *App) startContext() context.Context {
+	base := context.Background()
+	_ = app.DI.Resolve(&base)
+	return base
+}
+
+// setStartContext maps ctx as the context.Context of the module scopes, nil removes it again
+// so the scopes resolve the context.Context of the application injector.
+func setStartContext(entries []*moduleEntry, ctx context.Context) {
+	v := reflect.Value{}
+	if ctx != nil {
+		v = reflect.ValueOf(ctx)
+	}
+	for _, e := range entries {
+		if e.scope != nil {
+			e.scope.Set(contextType, v)
+		}
+	}
+}
+
+// startSequential starts the modules one after the other until one fails.
+// The Start of a module can resolve a context.Context, it is cancelled once the module has started.
+func (app *App) startSequential(entries []*moduleEntry) error {
+	base := app.startContext()
+	for _, e := range entries {
+		ctx, cancel := context.WithCancel(base)
+		setStartContext([]*moduleEntry{e}, ctx)
+		err := app.startEntry(e)
+		cancel()
+		setStartContext([]*moduleEntry{e}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startParallel starts the modules layer by layer, the modules of a layer are started
+// concurrently by at most workers goroutines. After the first failure the modules
+// that have not been started yet are skipped.
+// The Start of a module can resolve a context.Context, it is cancelled when another
+// module of the layer fails and once the layer has started, so it must not outlive Start.
+func (app *App) startParallel(ordered []string, deps map[string][]string, entries map[string]*moduleEntry, workers int) error {
+	var (
+		mu       sync.Mutex
+		firstErr error
+		failed   = zutil.NewBool(false)
+	)
+
+	base := app.startContext()
+	for _, layer := range moduleLayers(ordered, deps) {
+		batch := make([]*moduleEntry, 0, len(layer))
+		for _, name := range layer {
+			batch = append(batch, entries[name])
+		}
+		ctx, cancel := context.WithCancel(base)
+		setStartContext(batch, ctx)
+
+		wg := zsync.NewWaitGroup(uint(workers))
+		for _, name := range layer {
+			if failed.Load() {
+				break
+			}
+			e := entries[name]
+			wg.Go(func() {
+				if failed.Load() {
+					return
+				}
+				if err := app.startEntry(e); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					failed.Store(true)
+					cancel()
+				}
+			})
+		}
+		_ = wg.Wait()
+		cancel()
+		setStartContext(batch, nil)
+
+		if firstErr != nil {
+			return firstErr
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/zlog"
+)
+
+type (
+	testModule struct {
+		ModuleLifeCycle
+		name string
+	}
+	testValueA struct{ n int }
+	testValueB struct{ n int }
+	testShared struct{}
+)
+
+func (m *testModule) Name() string {
+	return m.name
+}
+
+// newTestApp builds the App like NewApp, from an injector with the given parent.
+func newTestApp(base BaseConf, parent ...zdi.Injector) *App {
+	di := zdi.New(parent...)
+	log := zlog.New()
+	log.Discard()
+	app := &App{DI: di, Conf: &Conf{Base: base}, Log: log}
+	app.DI = app.sharedInjector()
+	_ = di.Maps(app.DI, app.Conf, app)
+	return app
+}
+
+func TestParallelStartExports(t *testing.T) {
+	app := newTestApp(BaseConf{ParallelStart: 2})
+	app.DI.(zdi.Injector).Provide(func() *testShared { return &testShared{} })
+
+	start := func(v interface{}) func(zdi.Invoker) error {
+		return func(di zdi.Invoker) error {
+			var ctx context.Context
+			if err := di.Resolve(&ctx); err != nil {
+				return err
+			}
+			for i := 0; i < 100; i++ {
+				if _, err := di.Invoke(func(*testShared) {}); err != nil {
+					return err
+				}
+				if err := Export(di, v); err != nil {
+					return err
+				}
+			}
+			return ctx.Err()
+		}
+	}
+	modules := []Module{
+		&testModule{name: "a", ModuleLifeCycle: ModuleLifeCycle{OnStart: start(&testValueA{1})}},
+		&testModule{name: "b", ModuleLifeCycle: ModuleLifeCycle{OnStart: start(&testValueB{2})}},
+	}
+	if err := InitModule(modules, app); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		a *testValueA
+		b *testValueB
+	)
+	if err := app.DI.Resolve(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if a.n != 1 || b.n != 2 {
+		t.Fatalf("unexpected exports %v %v", a, b)
+	}
+}
+
+type testClient struct {
+	conf *Conf
+}
+
+func TestProviderResolvesAppValues(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		app := newTestApp(BaseConf{ParallelStart: workers})
+		var resolved *testClient
+		modules := []Module{
+			&testModule{name: "p", ModuleLifeCycle: ModuleLifeCycle{
+				OnLoad: func(di zdi.Invoker) (any, error) {
+					return func() *testClient {
+						var conf *Conf
+						_ = di.Resolve(&conf)
+						return &testClient{conf: conf}
+					}, nil
+				},
+			}},
+			&testModule{name: "u", ModuleLifeCycle: ModuleLifeCycle{
+				OnStart: func(di zdi.Invoker) error {
+					return di.Resolve(&resolved)
+				},
+			}},
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- InitModule(modules, app) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("InitModule with %d workers did not return", workers)
+		}
+		if resolved == nil || resolved.conf != app.Conf {
+			t.Fatalf("provider with %d workers did not resolve the app config", workers)
+		}
+	}
+}
+
+func TestProviderResolvesFromGoroutine(t *testing.T) {
+	app := newTestApp(BaseConf{ParallelStart: 2})
+	var resolved *testClient
+	modules := []Module{
+		&testModule{name: "p", ModuleLifeCycle: ModuleLifeCycle{
+			OnLoad: func(di zdi.Invoker) (any, error) {
+				return func() *testClient {
+					ch := make(chan *Conf)
+					go func() {
+						var conf *Conf
+						_ = di.Resolve(&conf)
+						ch <- conf
+					}()
+					return &testClient{conf: <-ch}
+				}, nil
+			},
+		}},
+		&testModule{name: "u", ModuleLifeCycle: ModuleLifeCycle{
+			OnStart: func(di zdi.Invoker) error {
+				return di.Resolve(&resolved)
+			},
+		}},
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- InitModule(modules, app) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("InitModule did not return")
+	}
+	if resolved == nil || resolved.conf != app.Conf {
+		t.Fatal("provider did not resolve the app config")
+	}
+}
+
+type testCtxKey struct{}
+
+func TestStartContext(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		app := newTestApp(BaseConf{ParallelStart: workers})
+		var (
+			scope zdi.Invoker
+			start context.Context
+		)
+		mod := &testModule{name: "ctx", ModuleLifeCycle: ModuleLifeCycle{
+			OnStart: func(di zdi.Invoker) error {
+				scope = di
+				return di.Resolve(&start)
+			},
+		}}
+		if err := InitModule([]Module{mod}, app); err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if start.Err() == nil {
+			t.Fatalf("%d workers: expected the start context to be cancelled once started", workers)
+		}
+
+		ctx := context.WithValue(context.Background(), testCtxKey{}, "app")
+		app.DI.(zdi.Injector).Map(ctx, zdi.WithInterface((*context.Context)(nil)))
+		var resolved context.Context
+		if err := scope.Resolve(&resolved); err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if resolved.Value(testCtxKey{}) != "app" {
+			t.Fatalf("%d workers: expected the context of the application injector", workers)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+)
+
+// provideTypes returns the types a value returned by Module.Load adds to the injector.
+func provideTypes(v reflect.Value) []reflect.Type {
+	if v.Kind() != reflect.Func {
+		return []reflect.Type{v.Type()}
+	}
+
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+	t := v.Type()
+	types := make([]reflect.Type, 0, t.NumOut())
+	for i := 0; i < t.NumOut(); i++ {
+		if t.Out(i) == errType {
+			continue
+		}
+		types = append(types, t.Out(i))
+	}
+	return types
+}
+
+// claimProviders records the module as provider of the types,
+// a type already provided by another module is reported as a collision.
+func (app *App) claimProviders(name string, types []reflect.Type) error {
+	r := app.registry()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.providers == nil {
+		r.providers = make(map[reflect.Type]string)
+	}
+
+	for _, t := range types {
+		owner, ok := r.providers[t]
+		if !ok || owner == name {
+			continue
+		}
+		msg := "DI type " + t.String() + " provided by " + name + " module collides with " + owner + " module"
+		if app.Conf != nil && app.Conf.Base.StrictDI {
+			return errors.New(msg)
+		}
+		app.Log.Warn(msg)
+	}
+
+	for _, t := range types {
+		r.providers[t] = name
+	}
+	return nil
+}
+
+// Providers returns the module that provided each type of the injector, keyed by type name.
+func (app *App) Providers() map[string]string {
+	r := app.registry()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	providers := make(map[string]string, len(r.providers))
+	for t, name := range r.providers {
+		providers[t.String()] = name
+	}
+	return providers
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sohaha/zlsgo/znet"
+	"github.com/sohaha/zlsgo/ztime/cron"
+	"github.com/sohaha/zlsgo/zutil"
+)
+
+type (
+	// moduleEntry is a module registered by InitModule.
+	moduleEntry struct {
+		mod        Module
+		vof        reflect.Value
+		cron       *cron.JobTable
+		router     *znet.Engine // router is the module router the routes are bound on, if any.
+		config     *moduleConf
+		scope      *moduleScope
+		active     *zutil.Bool
+		name       string
+		deps       []string
+		info       ModuleInfo
+		mu         sync.Mutex
+		loaded     bool
+		mounted    bool
+		reloadable bool
+	}
+
+	// moduleRegistry keeps track of the registered modules and of the started ones in start order.
+	moduleRegistry struct {
+		entries   map[string]*moduleEntry
+		providers map[reflect.Type]string
+		exports   *moduleExports
+		mounted   map[string]struct{} // mounted are the modules whose routes are bound on the Web, they stay bound once unregistered.
+		routers   []*znet.Engine      // routers hold the routes of the modules mounted while the Web serves.
+		bindings  []binding
+		// bindingBases are the []T and map[string]T mapped before the first binding of T.
+		bindingBases map[reflect.Type][2]reflect.Value
+		order        []string
+		started      []*moduleEntry
+		mu           sync.RWMutex
+		op           sync.Mutex // op serializes the runtime enabling and disabling of modules.
+		di           sync.Mutex // di serializes the access of the module scopes to the application injector.
+		ready        bool
+		serving      bool
+	}
+)
+
+var registryMu sync.Mutex
+
+func newModuleEntry(name string, mod Module, vof reflect.Value) *moduleEntry {
+	deps := getModuleDepends(mod)
+	return &moduleEntry{
+		mod:    mod,
+		vof:    vof,
+		name:   name,
+		deps:   deps,
+		active: zutil.NewBool(false),
+		info: ModuleInfo{
+			Name:      name,
+			Type:      vof.Type().String(),
+			State:     ModuleRegistered,
+			DependsOn: deps,
+			Timings:   make(map[string]time.Duration),
+		},
+	}
+}
+
+// registry returns the module registry of the application, creating it on first use.
+func (app *App) registry() *moduleRegistry {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if app.modules == nil {
+		app.modules = &moduleRegistry{entries: make(map[string]*moduleEntry)}
+	}
+	return app.modules
+}
+
+// add registers the module, the registration order is kept.
+func (r *moduleRegistry) add(e *moduleEntry) {
+	r.mu.Lock()
+	r.entries[e.name] = e
+	r.order = append(r.order, e.name)
+	r.mu.Unlock()
+}
+
+// remove unregisters the module.
+func (r *moduleRegistry) remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, name)
+	for i := range r.order {
+		if r.order[i] == name {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// get returns the registered module with the given name, or nil.
+func (r *moduleRegistry) get(name string) *moduleEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.entries[name]
+}
+
+// all returns the registered modules in registration order.
+func (r *moduleRegistry) all() []*moduleEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]*moduleEntry, 0, len(r.order))
+	for _, name := range r.order {
+		entries = append(entries, r.entries[name])
+	}
+	return entries
+}
+
+// activeEntries returns the running modules by name.
+func (r *moduleRegistry) activeEntries() map[string]*moduleEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make(map[string]*moduleEntry, len(r.entries))
+	for name, e := range r.entries {
+		if e.active.Load() {
+			entries[name] = e
+		}
+	}
+	return entries
+}
+
+// markStarted records that the module completed Start.
+func (r *moduleRegistry) markStarted(e *moduleEntry) {
+	r.mu.Lock()
+	r.started = append(r.started, e)
+	r.mu.Unlock()
+}
+
+// removeStarted forgets that the module has been started.
+func (r *moduleRegistry) removeStarted(e *moduleEntry) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.started {
+		if r.started[i] == e {
+			r.started = append(r.started[:i], r.started[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// popStarted removes and returns the started modules in reverse start order.
+func (r *moduleRegistry) popStarted() []*moduleEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]*moduleEntry, 0, len(r.started))
+	for i := len(r.started) - 1; i >= 0; i-- {
+		entries = append(entries, r.started[i])
+	}
+	r.started = nil
+	r.ready = false
+	return entries
+}
+
+// startedModules returns the started modules in start order.
+func (r *moduleRegistry) startedModules() []*moduleEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]*moduleEntry, len(r.started))
+	copy(entries, r.started)
+	return entries
+}
+
+// isMounted reports whether routes of a module with the name are bound on the Web.
+func (r *moduleRegistry) isMounted(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.mounted[name]
+	return ok
+}
+
+// setMounted records that the routes of the module are bound, router is the module router
+// they are bound on, nil when they are bound on the Web.
+func (r *moduleRegistry) setMounted(e *moduleEntry, router *znet.Engine) {
+	r.mu.Lock()
+	e.mounted = true
+	if router == nil {
+		if r.mounted == nil {
+			r.mounted = make(map[string]struct{})
+		}
+		r.mounted[e.name] = struct{}{}
+	} else {
+		e.router = router
+		r.routers = append(r.routers, router)
+	}
+	r.mu.Unlock()
+}
+
+// unmount drops the module router of the module, its routes are no longer dispatched.
+func (r *moduleRegistry) unmount(e *moduleEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.router == nil {
+		return
+	}
+	routers := make([]*znet.Engine, 0, len(r.routers))
+	for _, router := range r.routers {
+		if router != e.router {
+			routers = append(routers, router)
+		}
+	}
+	r.routers = routers
+	e.router = nil
+}
+
+// moduleRouters returns the module routers in mount order.
+func (r *moduleRegistry) moduleRouters() []*znet.Engine {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routers
+}
+
+func (r *moduleRegistry) isServing() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.serving
+}
+
+func (r *moduleRegistry) setReady(ready bool) {
+	r.mu.Lock()
+	r.ready = ready
+	r.mu.Unlock()
+}
+
+func (r *moduleRegistry) isReady() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ready
+}
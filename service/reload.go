@@ -0,0 +1,88 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/sohaha/zlsgo/ztype"
+)
+
+type (
+	// ConfChange describes a configuration change,
+	// Reload hooks that take a ConfChange argument receive the change of their own section.
+	ConfChange struct {
+		// Old is the value of the section before the change.
+		Old ztype.Type
+		// New is the value of the section after the change.
+		New ztype.Type
+		// Key is the key of the section, empty for hooks without a section.
+		Key string
+		// Changed are the changed key paths, sorted.
+		Changed []string
+	}
+
+	// reloadHook is a Reload function called after a configuration change and
+	// its optional PrepareReload function called before any hook is, to refuse the change.
+	// A hook with a key is only called when its section changed.
+	reloadHook struct {
+		fn      interface{}
+		prepare interface{}
+		key     string
+	}
+)
+
+// change returns the change of the section from old to new settings.
+func (h reloadHook) change(old, new ztype.Map, changed []string) ConfChange {
+	if h.key == "" {
+		return ConfChange{Old: ztype.New(old), New: ztype.New(new), Changed: changed}
+	}
+
+	prefix := h.key + "."
+	keyed := make([]string, 0)
+	for _, path := range changed {
+		if path == h.key || strings.HasPrefix(path, prefix) {
+			keyed = append(keyed, path)
+		}
+	}
+	return ConfChange{Key: h.key, Old: old.Get(h.key), New: new.Get(h.key), Changed: keyed}
+}
+
+// diffConf returns the key paths whose value differs between old and new.
+func diffConf(key string, old, new interface{}) []string {
+	om, oldIsMap := confMap(old)
+	nm, newIsMap := confMap(new)
+	if !oldIsMap || !newIsMap {
+		if reflect.DeepEqual(old, new) {
+			return nil
+		}
+		return []string{key}
+	}
+
+	keys := make([]string, 0, len(om)+len(nm))
+	for k := range om {
+		keys = append(keys, k)
+	}
+	for k := range nm {
+		if _, ok := om[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changed := make([]string, 0)
+	for _, k := range keys {
+		changed = append(changed, diffConf(joinKey(key, k), om[k], nm[k])...)
+	}
+	return changed
+}
+
+func confMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case ztype.Map:
+		return m, true
+	}
+	return nil, false
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/zfile"
+	"github.com/sohaha/zlsgo/ztype"
+)
+
+// Outcomes of a configuration reload.
+const (
+	ReloadCommitted  = "committed"
+	ReloadUnchanged  = "unchanged"
+	ReloadRejected   = "rejected"
+	ReloadRolledBack = "rolled_back"
+)
+
+// ReloadEvent is published once per reload of the config file.
+type ReloadEvent struct {
+	// Err is why the reload was rejected or rolled back.
+	Err error
+	// Status is one of ReloadCommitted, ReloadUnchanged, ReloadRejected and ReloadRolledBack.
+	Status string
+	// Stage is the stage that failed: read, validate, prepare or commit.
+	Stage string
+	// Changed are the changed key paths.
+	Changed  []string
+	Duration time.Duration
+}
+
+// SubscribeReload calls fn after every reload of the config file, until unsubscribe is called.
+func (app *App) SubscribeReload(fn func(ReloadEvent)) (unsubscribe func()) {
+	return app.subscribe(func(ev interface{}) {
+		if e, ok := ev.(ReloadEvent); ok {
+			fn(e)
+		}
+	})
+}
+
+// reloadConf reloads the config file as a transaction: the new file is read and validated,
+// the Reload hooks of the changed sections prepare it, then they are all called,
+// a failure at any stage restores the previous configuration and the hooks that already
+// succeeded are called again with the change reversed. It returns the settings in effect afterwards.
+func (app *App) reloadConf(prev ztype.Map) (ztype.Map, ReloadEvent) {
+	t := time.Now()
+	c := app.Conf
+	ev := ReloadEvent{Status: ReloadRejected}
+	done := func(settings ztype.Map) (ztype.Map, ReloadEvent) {
+		ev.Duration = time.Since(t)
+		return settings, ev
+	}
+
+	if err := c.read(); err != nil {
+		c.restore()
+		ev.Stage, ev.Err = "read", err
+		return done(prev)
+	}
+	current := c.all()
+	ev.Changed = diffConf("", map[string]interface{}(prev), map[string]interface{}(current))
+	if len(ev.Changed) == 0 {
+		c.keepGood()
+		ev.Status = ReloadUnchanged
+		return done(current)
+	}
+
+	if err := app.validateConf(); err != nil {
+		c.restore()
+		ev.Stage, ev.Err = "validate", err
+		return done(prev)
+	}
+
+	hooks := make([]reloadHook, 0, len(c.reloads))
+	changes := make([]ConfChange, 0, len(c.reloads))
+	for _, h := range c.reloads {
+		if ch := h.change(prev, current, ev.Changed); len(ch.Changed) > 0 {
+			hooks, changes = append(hooks, h), append(changes, ch)
+		}
+	}
+
+	var errs ModuleErrors
+	for i, h := range hooks {
+		if h.prepare == nil {
+			continue
+		}
+		if err := app.invokeReload(h.prepare, changes[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		c.restore()
+		ev.Stage, ev.Err = "prepare", errs
+		return done(prev)
+	}
+
+	c.autoUnmarshal()
+	app.reloadModuleConfs()
+	for i, h := range hooks {
+		err := app.invokeReload(h.fn, changes[i])
+		if err == nil {
+			continue
+		}
+
+		errs = append(errs, err)
+		c.restore()
+		c.autoUnmarshal()
+		app.reloadModuleConfs()
+		for j := i - 1; j >= 0; j-- {
+			undo := changes[j]
+			undo.Old, undo.New = undo.New, undo.Old
+			if err := app.invokeReload(hooks[j].fn, undo); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		ev.Status, ev.Stage, ev.Err = ReloadRolledBack, "commit", errs
+		return done(prev)
+	}
+
+	c.keepGood()
+	ev.Status = ReloadCommitted
+	return done(current)
+}
+
+// invokeReload calls a Reload or PrepareReload function with the change mapped into the injector.
+func (app *App) invokeReload(fn interface{}, ch ConfChange) error {
+	di := zdi.New(app.DI.(zdi.Injector))
+	_ = di.Map(ch)
+	return di.InvokeWithErrorOnly(fn)
+}
+
+// logReload reports the outcome of a reload.
+func (app *App) logReload(ev ReloadEvent) {
+	switch ev.Status {
+	case ReloadCommitted:
+		app.printLog("Config", "reloaded ["+strings.Join(ev.Changed, ", ")+"]")
+	case ReloadRejected, ReloadRolledBack:
+		msg := "config reload " + strings.Replace(ev.Status, "_", " ", 1) + " at " + ev.Stage
+		if ev.Err != nil {
+			msg += ": " + ev.Err.Error()
+		}
+		app.Log.Error(msg)
+	}
+}
+
+// keepGood keeps the content of the config files, the configuration is restored from it
+// when a later reload fails.
+func (c *Conf) keepGood() {
+	for _, l := range c.layers {
+		l.good = l.data
+	}
+
+	file := c.cfg.Core.ConfigFileUsed()
+	if file == "" || !zfile.FileExist(file) {
+		c.good = nil
+		return
+	}
+	if b, err := zfile.ReadFile(file); err == nil {
+		c.good = b
+	}
+}
+
+// restore brings back the configuration of the last good config files.
+func (c *Conf) restore() {
+	if err := c.cfg.Core.ReadConfig(bytes.NewReader(c.good)); err != nil {
+		_ = c.cfg.Core.ReadConfig(bytes.NewReader(nil))
+	}
+	for _, l := range c.layers {
+		l.data = l.good
+		if l.good != nil {
+			_ = c.cfg.Core.MergeConfigMap(l.good)
+		}
+	}
+	_ = c.resolve()
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newReloadApp builds the App of a reload test from the config file content.
+func newReloadApp(t *testing.T, content string) (*App, string) {
+	t.Helper()
+	file := testConfFile(t, content)
+	app := newTestApp(BaseConf{})
+	app.Conf = NewConf()(app.rootInjector())
+	return app, file
+}
+
+func writeConf(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadRejectedAtValidate(t *testing.T) {
+	app, file := newReloadApp(t, "[db]\nport = 3306\n")
+	app.Conf.sections = []interface{}{testDBConf{}}
+	called := false
+	app.Conf.reloads = append(app.Conf.reloads, reloadHook{key: "db", fn: func(ConfChange) error {
+		called = true
+		return nil
+	}})
+
+	prev := app.Conf.all()
+	writeConf(t, file, "[db]\nport = 0\n")
+	settings, ev := app.reloadConf(prev)
+	if ev.Status != ReloadRejected || ev.Stage != "validate" || ev.Err == nil {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if called {
+		t.Fatal("expected no hook to be called")
+	}
+	if app.Conf.Get("db.port").Int() != 3306 || settings.Get("db.port").Int() != 3306 {
+		t.Fatalf("expected the previous configuration, got %v", app.Conf.all())
+	}
+}
+
+func TestReloadRejectedAtPrepare(t *testing.T) {
+	app, file := newReloadApp(t, "[db]\nport = 3306\n")
+	var calls []string
+	app.Conf.reloads = append(app.Conf.reloads,
+		reloadHook{key: "db", fn: func(ConfChange) error {
+			calls = append(calls, "db")
+			return nil
+		}, prepare: func(ch ConfChange) error {
+			calls = append(calls, "prepare db")
+			if ch.New.Get("port").Int() != 5432 {
+				t.Errorf("unexpected change %+v", ch)
+			}
+			return errors.New("port is in use")
+		}},
+	)
+
+	prev := app.Conf.all()
+	writeConf(t, file, "[db]\nport = 5432\n")
+	_, ev := app.reloadConf(prev)
+	if ev.Status != ReloadRejected || ev.Stage != "prepare" || ev.Err == nil {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if !reflect.DeepEqual(calls, []string{"prepare db"}) {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	if app.Conf.Get("db.port").Int() != 3306 {
+		t.Fatalf("expected the previous configuration, got %v", app.Conf.all())
+	}
+}
+
+func TestReloadRolledBackAtCommit(t *testing.T) {
+	app, file := newReloadApp(t, "[a]\nv = 1\n\n[b]\nv = 1\n\n[c]\nv = 1\n")
+	var calls []string
+	hook := func(key string, err error) reloadHook {
+		return reloadHook{key: key, fn: func(ch ConfChange) error {
+			calls = append(calls, key+":"+ch.Old.Get("v").String()+"->"+ch.New.Get("v").String())
+			return err
+		}}
+	}
+	app.Conf.reloads = append(app.Conf.reloads, hook("a", nil), hook("b", errors.New("failed")), hook("c", nil))
+
+	prev := app.Conf.all()
+	writeConf(t, file, "[a]\nv = 2\n\n[b]\nv = 2\n\n[c]\nv = 2\n")
+	_, ev := app.reloadConf(prev)
+	if ev.Status != ReloadRolledBack || ev.Stage != "commit" || ev.Err == nil {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	// Only a, which succeeded, is called again with the change reversed.
+	if want := []string{"a:1->2", "b:1->2", "a:2->1"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+	for _, key := range []string{"a.v", "b.v", "c.v"} {
+		if app.Conf.Get(key).Int() != 1 {
+			t.Fatalf("expected the previous configuration, got %v", app.Conf.all())
+		}
+	}
+
+	// The next reload compares against the restored configuration.
+	calls = nil
+	writeConf(t, file, "[a]\nv = 1\n\n[b]\nv = 1\n\n[c]\nv = 3\n")
+	if _, ev = app.reloadConf(app.Conf.all()); ev.Status != ReloadCommitted || !reflect.DeepEqual(calls, []string{"c:1->3"}) {
+		t.Fatalf("unexpected reload %+v %v", ev, calls)
+	}
+}
+
+func TestConfRestore(t *testing.T) {
+	file := testConfFile(t, "[db]\nhost = 'a'\nport = 1\n")
+	local := filepath.Join(filepath.Dir(file), "app.local.toml")
+	writeConf(t, local, "[db]\nport = 2\n")
+	c := NewConf()(newTestApp(BaseConf{}).rootInjector())
+	if c.Get("db.host").String() != "a" || c.Get("db.port").Int() != 2 {
+		t.Fatalf("unexpected configuration %v", c.all())
+	}
+
+	writeConf(t, file, "[db]\nhost = 'b'\nport = 1\nname = 'x'\n")
+	writeConf(t, local, "[db]\nport = 3\n")
+	if err := c.read(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Get("db.host").String() != "b" || c.Get("db.port").Int() != 3 {
+		t.Fatalf("unexpected configuration %v", c.all())
+	}
+
+	c.restore()
+	if c.Get("db.host").String() != "a" || c.Get("db.port").Int() != 2 || c.Get("db.name").Exists() {
+		t.Fatalf("expected the previous configuration, got %v", c.all())
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/znet"
+)
+
+var routerSeq uint64
+
+// dispatchedKey marks a request already handed to the module routers,
+// the not found answer of an inactive module must not dispatch it again.
+const dispatchedKey = "app_core.module_router"
+
+// newModuleRouter returns a router with the settings of the Web for the routes of a module
+// mounted while the Web serves, the requests no route of the Web matches are dispatched to it.
+func newModuleRouter(web *Web) *Web {
+	name := "app_core-module-" + strconv.FormatUint(atomic.AddUint64(&routerSeq, 1), 10)
+	r := znet.New(name)
+	r.Log = web.Log
+	r.AllowQuerySemicolons = web.AllowQuerySemicolons
+	r.BindStructSuffix = web.BindStructSuffix
+	r.BindStructDelimiter = web.BindStructDelimiter
+	r.SetMode(web.GetMode())
+	r.Injector().(zdi.Injector).SetParent(web.Injector().(zdi.Injector))
+	return &Web{Engine: r}
+}
+
+// serve marks the Web as serving: from now on the routes of the modules mounted at runtime
+// are bound on module routers, reached from the not found path of the Web.
+func (app *App) serve(web *Web) {
+	r := app.registry()
+	r.op.Lock()
+	defer r.op.Unlock()
+
+	web.Use(dispatchModuleRouters(r))
+	r.mu.Lock()
+	r.serving = true
+	r.mu.Unlock()
+}
+
+// dispatchModuleRouters is the last middleware of the Web, on the not found path
+// it hands the request to the first module router with a matching route.
+func dispatchModuleRouters(r *moduleRegistry) znet.Handler {
+	return func(c *znet.Context) {
+		if _, ok := c.Value(dispatchedKey); !ok && c.PrevContent().Code.Load() == http.StatusNotFound {
+			c.WithValue(dispatchedKey, true)
+			for _, router := range r.moduleRouters() {
+				if !router.FindHandle(c, c.Request, c.Request.URL.Path, true) {
+					return
+				}
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/sohaha/zlsgo/zreflect"
+)
+
+// RegisterModule activates a module while the application is running:
+// it runs Load, Start and Done, schedules its tasks and mounts its controllers on the live Web.
+// The modules it depends on must already be running.
+func (app *App) RegisterModule(mod Module) error {
+	r := app.registry()
+	r.op.Lock()
+	defer r.op.Unlock()
+
+	vof := zreflect.ValueOf(mod)
+	name := getModuleName(mod, vof)
+	if r.get(name) != nil {
+		return errors.New(name + " module: already registered")
+	}
+
+	scope := assignModule(app, mod)
+	web, _ := getWeb(app)
+	e := newModuleEntry(name, mod, vof)
+	e.scope = scope
+	r.add(e)
+
+	if err := app.enableModule(web, e); err != nil {
+		app.unmapModule(e)
+		r.unmount(e)
+		r.remove(name)
+		return err
+	}
+
+	return nil
+}
+
+// UnregisterModule deactivates a module registered by InitModule or RegisterModule:
+// it stops the module and its tasks, its routes are unbound or answer not found
+// and the DI values it provided are removed.
+// A module registered again under the same name mounts its own controllers.
+func (app *App) UnregisterModule(name string) error {
+	r := app.registry()
+	r.op.Lock()
+	defer r.op.Unlock()
+
+	e := r.get(name)
+	if e == nil {
+		return errors.New(name + " module: not registered")
+	}
+
+	if err := app.disableModule(e); err != nil {
+		return err
+	}
+
+	app.unmapModule(e)
+	r.unmount(e)
+	r.remove(name)
+	app.printLog("Module", "unregistered "+name)
+	return nil
+}
+
+// unmapModule removes the module and the values it shared or bound from the injector,
+// a type also shared by another module resolves to the value of that module again.
+func (app *App) unmapModule(e *moduleEntry) {
+	x := app.exports()
+	if x == nil {
+		return
+	}
+
+	x.remove(e.name)
+	r := app.registry()
+	r.mu.Lock()
+	for t, owner := range r.providers {
+		if owner != e.name {
+			continue
+		}
+		if owner, ok := x.owner(t); ok && owner != "" {
+			r.providers[t] = owner
+		} else {
+			delete(r.providers, t)
+		}
+	}
+	r.mu.Unlock()
+
+	app.unbindModule(e.name)
+}
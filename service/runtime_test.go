@@ -0,0 +1,185 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/znet"
+)
+
+type testVersionController struct {
+	Path    string
+	version string
+}
+
+func (c *testVersionController) Init(r *znet.Engine) error {
+	return nil
+}
+
+func (c *testVersionController) GetPing(z *znet.Context) {
+	z.String(http.StatusOK, c.version)
+}
+
+func TestRegisterModuleWhileServing(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	if err := InitModule(nil, app); err != nil {
+		t.Fatal(err)
+	}
+	web, _ := getWeb(app)
+	app.serve(web)
+
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		web.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code, w.Body.String()
+	}
+	newModule := func(controllers ...Controller) Module {
+		return &testModule{name: "runtime", ModuleLifeCycle: ModuleLifeCycle{
+			Service: &ModuleService{Controllers: controllers},
+		}}
+	}
+
+	if err := app.RegisterModule(newModule(&testVersionController{Path: "/runtime", version: "v1"})); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := get("/runtime/ping"); code != http.StatusOK || body != "v1" {
+		t.Fatalf("expected the route of the module, got %d %q", code, body)
+	}
+
+	if err := app.UnregisterModule("runtime"); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get("/runtime/ping"); code != http.StatusNotFound {
+		t.Fatalf("expected not found once unregistered, got %d", code)
+	}
+
+	if err := app.RegisterModule(newModule(
+		&testVersionController{Path: "/runtime", version: "v2"},
+		&testVersionController{Path: "/runtime2", version: "v2"},
+	)); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/runtime/ping", "/runtime2/ping"} {
+		if code, body := get(path); code != http.StatusOK || body != "v2" {
+			t.Fatalf("expected the module registered again to serve %s, got %d %q", path, code, body)
+		}
+	}
+}
+
+func TestRegisterModuleAgainBeforeServing(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	newModule := func(version string) Module {
+		return &testModule{name: "runtime", ModuleLifeCycle: ModuleLifeCycle{
+			Service: &ModuleService{Controllers: []Controller{&testVersionController{Path: "/runtime", version: version}}},
+		}}
+	}
+	if err := InitModule([]Module{newModule("v1")}, app); err != nil {
+		t.Fatal(err)
+	}
+	web, _ := getWeb(app)
+	if err := app.UnregisterModule("runtime"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RegisterModule(newModule("v2")); err != nil {
+		t.Fatal(err)
+	}
+	app.serve(web)
+
+	w := httptest.NewRecorder()
+	web.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/runtime/ping", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "v2" {
+		t.Fatalf("expected the module registered again, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestExportsKeepParentInjector(t *testing.T) {
+	type parentValue struct{}
+	parent := zdi.New()
+	_ = parent.Map(&parentValue{})
+
+	app := newTestApp(BaseConf{}, parent)
+	app.DI.(zdi.Injector).Provide(func(a *testValueA) *testValueB { return &testValueB{a.n} })
+	mod := &testModule{name: "exporter", ModuleLifeCycle: ModuleLifeCycle{
+		OnStart: func(di zdi.Invoker) error { return Export(di, &testValueA{1}) },
+	}}
+	if err := InitModule([]Module{mod}, app); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		v *parentValue
+		a *testValueA
+		b *testValueB
+	)
+	if err := app.DI.Resolve(&v, &a, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replacing the parent keeps the exports.
+	type otherValue struct{}
+	other := zdi.New()
+	_ = other.Map(&otherValue{})
+	app.DI.(zdi.Injector).SetParent(other)
+	var o *otherValue
+	if err := app.DI.Resolve(&o, &a); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testDependent struct {
+	testModule
+	deps []string
+}
+
+func (m *testDependent) DependsOn() []string {
+	return m.deps
+}
+
+func TestInitModuleRunningDependency(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	if err := InitModule([]Module{&testModule{name: "base"}}, app); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := &testDependent{testModule: testModule{name: "dependent"}, deps: []string{"base"}}
+	if err := InitModule([]Module{mod}, app); err != nil {
+		t.Fatal(err)
+	}
+	if e := app.registry().get("dependent"); e == nil || !e.active.Load() {
+		t.Fatal("expected the dependent module to run")
+	}
+}
+
+type testStringer struct{ s string }
+
+func (s *testStringer) String() string { return s.s }
+
+type testOtherStringer struct{ testStringer }
+
+func TestExportsReplaceAndLatest(t *testing.T) {
+	app := newTestApp(BaseConf{})
+	x := app.exports()
+	st := reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+	for i := 0; i < 3; i++ {
+		x.set("a", reflect.TypeOf(&testStringer{}), reflect.ValueOf(&testStringer{"a"}))
+	}
+	if n := len(x.values[reflect.TypeOf(&testStringer{})]); n != 1 {
+		t.Fatalf("expected 1 value, got %d", n)
+	}
+
+	for i := 0; i < 50; i++ {
+		x.set("b", reflect.TypeOf(&testOtherStringer{}), reflect.ValueOf(&testOtherStringer{testStringer{"b"}}))
+		if v, _ := x.get(st); v.Interface().(fmt.Stringer).String() != "b" {
+			t.Fatal("expected the latest export to implement the interface")
+		}
+		x.set("a", reflect.TypeOf(&testStringer{}), reflect.ValueOf(&testStringer{"a"}))
+		if v, _ := x.get(st); v.Interface().(fmt.Stringer).String() != "a" {
+			t.Fatal("expected the latest export to implement the interface")
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/sohaha/zlsgo/zdi"
+)
+
+// moduleScope is the injector of a module: the values mapped into it stay private to the module,
+// the types it does not hold are resolved from the application injector.
+type moduleScope struct {
+	zdi.Injector
+	parent zdi.Injector
+	app    *App
+	name   string
+}
+
+func newModuleScope(app *App, name string) *moduleScope {
+	parent := app.sharedInjector()
+	return &moduleScope{
+		Injector: zdi.New(parent),
+		parent:   parent,
+		app:      app,
+		name:     name,
+	}
+}
+
+// invoker returns the injector the lifecycle methods of the module receive.
+func (e *moduleEntry) invoker(app *App) zdi.Invoker {
+	if e.scope != nil {
+		return e.scope
+	}
+	return app.DI
+}
+
+// Export maps the values into the application injector, so every module can resolve them.
+// di is the injector the module received, the values are recorded as provided by the module.
+// Outside of a module the values are mapped into di itself.
+func Export(di zdi.Invoker, values ...interface{}) error {
+	for i := range values {
+		if err := export(di, reflect.TypeOf(values[i]), reflect.ValueOf(values[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportAs is like Export but maps the value under the type ptr points to,
+// e.g. ExportAs(di, (*http.RoundTripper)(nil), transport).
+func ExportAs(di zdi.Invoker, ptr interface{}, value interface{}) error {
+	t := reflect.TypeOf(ptr)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return errors.New("export type must be a pointer, e.g. (*MyInterface)(nil)")
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || !v.Type().AssignableTo(t.Elem()) {
+		return errors.New("exported value is not assignable to " + t.Elem().String())
+	}
+	return export(di, t.Elem(), v)
+}
+
+func export(di zdi.Invoker, t reflect.Type, v reflect.Value) error {
+	if t == nil {
+		return errors.New("cannot export nil")
+	}
+
+	if s, ok := di.(*moduleScope); ok {
+		if err := s.app.claimProviders(s.name, []reflect.Type{t}); err != nil {
+			return err
+		}
+		s.app.exports().set(s.name, t, v)
+		return nil
+	}
+
+	inj, ok := di.(zdi.Injector)
+	if !ok {
+		return errors.New("export requires a zdi.Injector")
+	}
+	inj.Set(t, v)
+	return nil
+}
+
+// shareValue maps the value shared by a module into the application injector, a function is provided.
+// The values shared through a module scope are recorded with the module, so they can be removed.
+func shareValue(di zdi.Invoker, v reflect.Value) {
+	if s, ok := di.(*moduleScope); ok {
+		if v.Kind() == reflect.Func {
+			s.app.exports().provide(s.name, v)
+		} else {
+			s.app.exports().set(s.name, v.Type(), v)
+		}
+		return
+	}
+
+	inj, ok := di.(zdi.Injector)
+	if !ok {
+		return
+	}
+	if v.Kind() == reflect.Func {
+		inj.Provide(v.Interface())
+	} else {
+		inj.Map(v.Interface())
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sohaha/zlsgo/zfile"
+	"github.com/sohaha/zlsgo/zstring"
+	"github.com/sohaha/zlsgo/ztype"
+)
+
+// EncryptedPrefix marks a config value encrypted by EncryptConfValue.
+const EncryptedPrefix = "enc:"
+
+var (
+	// ConfSecretKey is the key decrypting the enc: values of the configuration,
+	// when empty it is read from the environment variable <AppName>_CONF_KEY or ConfSecretKeyEnv.
+	ConfSecretKey = ""
+
+	// ConfSecretKeyEnv is the environment variable holding the key of the enc: values.
+	ConfSecretKeyEnv = "APP_CONF_KEY"
+)
+
+// EncryptConfValue encrypts the value with AES-GCM into an enc: config value,
+// the key must be 16, 24 or 32 bytes long.
+func EncryptConfValue(value, key string) (string, error) {
+	s, err := zstring.AesGCMEncryptString(value, key)
+	if err != nil {
+		return "", err
+	}
+	return EncryptedPrefix + s, nil
+}
+
+func confSecretKey() string {
+	if ConfSecretKey != "" {
+		return ConfSecretKey
+	}
+	for _, key := range []string{strings.ToUpper(AppName) + "_CONF_KEY", ConfSecretKeyEnv} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// resolveSecrets returns a copy of the value with the secret references of its strings resolved:
+// ${env:NAME} and ${file:/path} are replaced by the environment variable and the trimmed file content,
+// a string starting with enc: is decrypted with the config secret key.
+// Errors name the key path and the reference, never the secret.
+func resolveSecrets(key string, v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k := range val {
+			r, err := resolveSecrets(joinKey(key, k), val[k])
+			if err != nil {
+				return nil, err
+			}
+			m[k] = r
+		}
+		return m, nil
+	case ztype.Map:
+		m, err := resolveSecrets(key, map[string]interface{}(val))
+		if err != nil {
+			return nil, err
+		}
+		return ztype.Map(m.(map[string]interface{})), nil
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i := range val {
+			r, err := resolveSecrets(key+"["+strconv.Itoa(i)+"]", val[i])
+			if err != nil {
+				return nil, err
+			}
+			s[i] = r
+		}
+		return s, nil
+	case []map[string]interface{}:
+		s := make([]map[string]interface{}, len(val))
+		for i := range val {
+			r, err := resolveSecrets(key+"["+strconv.Itoa(i)+"]", val[i])
+			if err != nil {
+				return nil, err
+			}
+			s[i] = r.(map[string]interface{})
+		}
+		return s, nil
+	case string:
+		s, err := resolveString(val)
+		if err != nil {
+			return nil, errors.New("config " + key + ": " + err.Error())
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+func resolveString(s string) (string, error) {
+	if strings.HasPrefix(s, EncryptedPrefix) {
+		key := confSecretKey()
+		if key == "" {
+			return "", errors.New("encrypted value but no secret key, set " + strings.ToUpper(AppName) + "_CONF_KEY")
+		}
+		plain, err := zstring.AesGCMDecryptString(strings.TrimPrefix(s, EncryptedPrefix), key)
+		if err != nil {
+			return "", errors.New("failed to decrypt value: " + err.Error())
+		}
+		return plain, nil
+	}
+
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			break
+		}
+		ref := s[i+2 : i+j]
+		value, ok, err := resolveRef(ref)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s[:i])
+		if ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(s[i : i+j+1])
+		}
+		s = s[i+j+1:]
+	}
+	b.WriteString(s)
+	return b.String(), nil
+}
+
+// resolveRef resolves env:NAME and file:/path, other references are left as they are.
+func resolveRef(ref string) (value string, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok = os.LookupEnv(name)
+		if !ok {
+			err = errors.New("environment variable " + name + " is not set")
+		}
+		return
+	case strings.HasPrefix(ref, "file:"):
+		path := strings.TrimPrefix(ref, "file:")
+		b, e := zfile.ReadFile(path)
+		if e != nil {
+			return "", false, errors.New("failed to read secret file " + path)
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	}
+	return "", false, nil
+}
+
+// resolve resolves the secret references of the current settings,
+// the resolved settings are only kept by Conf so they never reach the config file.
+func (c *Conf) resolve() error {
+	all, err := resolveSecrets("", c.cfg.GetAll(true))
+	if err != nil {
+		return err
+	}
+	c.resolved = all.(ztype.Map)
+	return nil
+}
+
+// all returns the current settings with the secret references resolved.
+func (c *Conf) all() ztype.Map {
+	if c.resolved == nil {
+		if err := c.resolve(); err != nil {
+			return c.cfg.GetAll()
+		}
+	}
+	return c.resolved
+}
+
+func (c *Conf) unmarshalKey(key string, v interface{}) error {
+	return ztype.To(c.all().Get(key).Value(), v)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sohaha/zlsgo/zdi"
+	"github.com/sohaha/zlsgo/zerror"
+	"github.com/sohaha/zlsgo/zreflect"
+)
+
+// ModuleStopTimeout is implemented by modules that need a shutdown deadline
+// other than the one configured by BaseConf.ShutdownTimeout.
+type ModuleStopTimeout interface {
+	StopTimeout() time.Duration
+}
+
+// ModuleErrors collects the errors of an operation that involves several modules.
+type ModuleErrors []error
+
+func (e ModuleErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for i := range e {
+		msgs = append(msgs, strings.Join(zerror.UnwrapErrors(e[i]), ": "))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Err returns nil if there is no error, otherwise the errors themselves.
+func (e ModuleErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// StopModules stops the started modules in reverse start order,
+// every module gets its own deadline and all failures are returned together, left to the caller to report.
+func StopModules(app *App) error {
+	var entries []*moduleEntry
+	if app.modules != nil {
+		entries = app.modules.popStarted()
+	} else {
+		var ps []Module
+		if err := app.DI.Resolve(&ps); err == nil {
+			for i := len(ps) - 1; i >= 0; i-- {
+				vof := zreflect.ValueOf(ps[i])
+				entries = append(entries, newModuleEntry(getModuleName(ps[i], vof), ps[i], vof))
+			}
+		}
+	}
+
+	var errs ModuleErrors
+	for _, e := range entries {
+		if err := stopModule(app, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.Err()
+}
+
+// stopModule calls the Stop method of the module, if any, within its deadline.
+// The deadline is available to Stop through an injected context.Context.
+func stopModule(app *App, e *moduleEntry) error {
+	t := time.Now()
+	err := callStop(app, e)
+	app.record(e, PhaseStop, ModuleStopped, time.Since(t), err)
+	return err
+}
+
+func callStop(app *App, e *moduleEntry) error {
+	e.active.Store(false)
+	if e.cron != nil {
+		e.cron.Stop()
+	}
+
+	stop := e.vof.MethodByName("Stop")
+	if !stop.IsValid() {
+		return nil
+	}
+
+	timeout := getStopTimeout(app, e.mod)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	di := zdi.New(e.invoker(app).(zdi.Injector))
+	_ = di.Map(ctx, zdi.WithInterface((*context.Context)(nil)))
+	_ = di.Map(di, zdi.WithInterface((*zdi.Invoker)(nil)))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- zerror.TryCatch(func() error {
+			return di.InvokeWithErrorOnly(stop.Interface())
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return zerror.With(err, e.name+" module: failed to Stop")
+		}
+		return nil
+	case <-ctx.Done():
+		return zerror.With(errors.New("timed out after "+timeout.String()), e.name+" module: failed to Stop")
+	}
+}
+
+func getStopTimeout(app *App, mod Module) time.Duration {
+	if t, ok := mod.(ModuleStopTimeout); ok {
+		if timeout := t.StopTimeout(); timeout > 0 {
+			return timeout
+		}
+	}
+
+	if app.Conf != nil && app.Conf.Base.ShutdownTimeout > 0 {
+		return time.Duration(app.Conf.Base.ShutdownTimeout) * time.Second
+	}
+
+	return time.Duration(baseConf.ShutdownTimeout) * time.Second
+}
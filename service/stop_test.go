@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sohaha/zlsgo/zdi"
+)
+
+type testSlowModule struct {
+	testModule
+	timeout time.Duration
+}
+
+func (m *testSlowModule) StopTimeout() time.Duration {
+	return m.timeout
+}
+
+func TestStopModules(t *testing.T) {
+	app := newTestApp(BaseConf{ShutdownTimeout: 60})
+
+	var (
+		mu      sync.Mutex
+		stopped []string
+	)
+	release := make(chan struct{})
+	defer close(release)
+	stop := func(name string, err error, block bool) func(zdi.Invoker) error {
+		return func(di zdi.Invoker) error {
+			var ctx context.Context
+			if err := di.Resolve(&ctx); err != nil {
+				return err
+			}
+			if _, ok := ctx.Deadline(); !ok {
+				return errors.New("no deadline")
+			}
+			mu.Lock()
+			stopped = append(stopped, name)
+			mu.Unlock()
+			if block {
+				<-release
+			}
+			return err
+		}
+	}
+	modules := []Module{
+		&testModule{name: "a", ModuleLifeCycle: ModuleLifeCycle{OnStop: stop("a", errors.New("closed twice"), false)}},
+		&testSlowModule{testModule: testModule{name: "b", ModuleLifeCycle: ModuleLifeCycle{OnStop: stop("b", nil, true)}}, timeout: 50 * time.Millisecond},
+		&testModule{name: "c", ModuleLifeCycle: ModuleLifeCycle{OnStop: stop("c", nil, false)}},
+	}
+	if err := InitModule(modules, app); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	err := StopModules(app)
+	if elapsed := time.Since(now); elapsed > 5*time.Second {
+		t.Fatalf("expected the stop of b to time out after its own deadline, took %s", elapsed)
+	}
+
+	mu.Lock()
+	order := strings.Join(stopped, ",")
+	mu.Unlock()
+	if order != "c,b,a" {
+		t.Fatalf("expected the reverse start order, got %s", order)
+	}
+
+	errs, ok := err.(ModuleErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected the errors of a and b, got %v", err)
+	}
+	for _, want := range []string{"b module: failed to Stop: timed out after 50ms", "a module: failed to Stop: closed twice"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %q", want, err.Error())
+		}
+	}
+	if strings.Index(err.Error(), "b module") > strings.Index(err.Error(), "a module") {
+		t.Fatalf("expected the errors in stop order, got %q", err.Error())
+	}
+
+	if err := StopModules(app); err != nil {
+		t.Fatalf("expected the modules to be stopped once, got %v", err)
+	}
+}
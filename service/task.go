@@ -16,11 +16,17 @@ type Task struct {
 
 // InitTask initializes the tasks using the provided *App.
 func InitTask(tasks *[]Task, app *App) (err error) {
+	_, err = initTask(tasks, app)
+	return
+}
+
+// initTask schedules the tasks and returns the job table running them.
+func initTask(tasks *[]Task, app *App) (t *cron.JobTable, err error) {
 	if len(*tasks) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	t := cron.New()
+	t = cron.New()
 
 	app.Log.Debug(app.Log.ColorTextWrap(zlog.ColorLightBlue, zstring.Pad("Cron", 6, " ", zstring.PadLeft)), "Register ")
 	for i := range *tasks {
@@ -39,7 +45,7 @@ func InitTask(tasks *[]Task, app *App) (err error) {
 			}
 		})
 		if err != nil {
-			return
+			return nil, err
 		}
 
 		next, _ := cron.ParseNextTime(task.Cron)
@@ -47,5 +53,5 @@ func InitTask(tasks *[]Task, app *App) (err error) {
 	}
 
 	t.Run()
-	return nil
+	return t, nil
 }
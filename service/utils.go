@@ -1,6 +1,8 @@
 package service
 
 import (
+	"time"
+
 	"github.com/sohaha/zlsgo/zdi"
 )
 
@@ -10,6 +12,22 @@ type (
 
 var Utils = utils{}
 
+// LoadModule runs the Load phase of the module and adds its result to the injector,
+// the types it provides are tracked by the application resolved from the injector.
+// Through the injector of a module the types belong to that module, e.g. a group and not its child.
 func (utils) LoadModule(di zdi.Injector, name string, mod Module) error {
-	return loadModule(di, name, mod)
+	var app *App
+	_ = di.Resolve(&app)
+	return loadModule(app, di, name, mod)
+}
+
+// SortModules orders the module names so that every module comes after its dependencies,
+// modules without ordering constraints between them keep the given order.
+func (utils) SortModules(names []string, deps map[string][]string) ([]string, error) {
+	return sortModules(names, deps)
+}
+
+// StopTimeout returns the deadline the module has to stop, from ModuleStopTimeout or BaseConf.ShutdownTimeout.
+func (utils) StopTimeout(app *App, mod Module) time.Duration {
+	return getStopTimeout(app, mod)
 }
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sohaha/zlsgo/zreflect"
+	"github.com/sohaha/zlsgo/ztype"
+)
+
+type (
+	// ValidationError is a configuration value that breaks a rule of its validate tag.
+	ValidationError struct {
+		Key     string `json:"key"`
+		Rule    string `json:"rule"`
+		Message string `json:"message"`
+	}
+
+	// ValidationErrors are all the violations found in the configuration.
+	ValidationErrors []ValidationError
+)
+
+func (e ValidationError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for i := range e {
+		msgs = append(msgs, e[i].Error())
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Err returns nil if there is no violation, otherwise the violations themselves.
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ValidateConf checks the struct value against the validate tags of its fields,
+// key is the config key of the value and prefixes the key paths of the violations.
+//
+// The rules of a validate tag are separated by commas:
+// required, min=N, max=N (the value of numbers, the length of strings, slices and maps),
+// oneof=a b c, duration (a string parsed by time.ParseDuration) and regexp=EXPR,
+// regexp takes the rest of the tag so it must come last.
+func ValidateConf(key string, value interface{}) error {
+	var errs ValidationErrors
+	validateValue(key, reflect.ValueOf(value), &errs)
+	return errs.Err()
+}
+
+func validateValue(key string, v reflect.Value, errs *ValidationErrors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				validateValue(key, v.Field(i), errs)
+				continue
+			}
+			name, _ := zreflect.GetStructTag(f)
+			if name == "" {
+				if f.Tag.Get("z") == "-" || f.Tag.Get("json") == "-" {
+					continue
+				}
+				name = f.Name
+			}
+			path := joinKey(key, name)
+			if rules := f.Tag.Get("validate"); rules != "" {
+				validateRules(path, v.Field(i), rules, errs)
+			}
+			validateValue(path, v.Field(i), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(key+"["+strconv.Itoa(i)+"]", v.Index(i), errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(joinKey(key, ztype.ToString(iter.Key().Interface())), iter.Value(), errs)
+		}
+	}
+}
+
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+func validateRules(key string, v reflect.Value, rules string, errs *ValidationErrors) {
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "regexp=") {
+			rule, rules = rules, ""
+		} else if i := strings.IndexByte(rules, ','); i >= 0 {
+			rule, rules = rules[:i], rules[i+1:]
+		} else {
+			rule, rules = rules, ""
+		}
+
+		name, param := strings.TrimSpace(rule), ""
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, param = name[:i], name[i+1:]
+		}
+		if name == "" {
+			continue
+		}
+
+		if msg := checkRule(v, name, param); msg != "" {
+			*errs = append(*errs, ValidationError{Key: key, Rule: name, Message: msg})
+		}
+	}
+}
+
+// checkRule returns why the value breaks the rule, or an empty string.
+func checkRule(v reflect.Value, rule, param string) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if rule == "required" {
+				return "is required"
+			}
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch rule {
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		n, limit, err := ruleNumber(v, param)
+		if err != nil {
+			return "invalid rule " + rule + "=" + param
+		}
+		if rule == "min" && n < limit {
+			return "must be at least " + param
+		}
+		if rule == "max" && n > limit {
+			return "must be at most " + param
+		}
+	case "oneof":
+		s := ztype.ToString(v.Interface())
+		for _, o := range strings.Fields(param) {
+			if s == o {
+				return ""
+			}
+		}
+		return "must be one of [" + strings.Join(strings.Fields(param), ", ") + "]"
+	case "regexp":
+		re, err := regexp.Compile(param)
+		if err != nil {
+			return "invalid rule regexp=" + param
+		}
+		if s := ztype.ToString(v.Interface()); !re.MatchString(s) {
+			return "must match " + param
+		}
+	case "duration":
+		if v.Kind() != reflect.String {
+			return ""
+		}
+		if s := v.String(); s != "" {
+			if _, err := time.ParseDuration(s); err != nil {
+				return "must be a duration, e.g. 1m30s"
+			}
+		}
+	default:
+		return "unknown rule " + rule
+	}
+	return ""
+}
+
+// ruleNumber returns the value compared by min and max and the limit of the rule.
+func ruleNumber(v reflect.Value, param string) (n, limit float64, err error) {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		n = float64(v.Len())
+	case reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			if d, err := time.ParseDuration(param); err == nil {
+				return float64(v.Int()), float64(d), nil
+			}
+		}
+		n = float64(v.Int())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	}
+	limit, err = strconv.ParseFloat(param, 64)
+	return
+}
+
+// violations returns the errors of reading or validating a config section as ValidationErrors.
+func violations(key string, err error) ValidationErrors {
+	if errs, ok := err.(ValidationErrors); ok {
+		return errs
+	}
+	return ValidationErrors{{Key: key, Rule: "type", Message: err.Error()}}
+}
+
+// validate checks the registered default confs against the current configuration.
+func (c *Conf) validate() error {
+	if c.cfg == nil {
+		return nil
+	}
+
+	var errs ValidationErrors
+	for _, value := range c.sections {
+		v := reflect.ValueOf(value)
+		t := reflect.Indirect(v).Type()
+		if t.Kind() != reflect.Struct && t.Kind() != reflect.Slice {
+			continue
+		}
+
+		name, _ := getConfName(v)
+		val := reflect.New(t)
+		val.Elem().Set(reflect.Indirect(v))
+		err := c.unmarshalKey(name, val.Interface())
+		if err == nil {
+			err = ValidateConf(strings.ToLower(name), val.Interface())
+		}
+		if err != nil {
+			errs = append(errs, violations(strings.ToLower(name), err)...)
+		}
+	}
+	return errs.Err()
+}
+
+// validateConf checks the registered default confs and the module config sections.
+func (app *App) validateConf() error {
+	var errs ValidationErrors
+	if app.Conf != nil {
+		if err := app.Conf.validate(); err != nil {
+			errs = append(errs, err.(ValidationErrors)...)
+		}
+	}
+
+	for _, e := range app.registry().all() {
+		if e.config == nil {
+			continue
+		}
+		if _, err := app.readModuleConf(e.config); err != nil {
+			errs = append(errs, err.(ValidationErrors)...)
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sohaha/zlsgo/zdi"
+)
+
+type testRulesConf struct {
+	Name    string        `z:"name" validate:"required"`
+	Port    int           `z:"port" validate:"min=1,max=65535"`
+	Tags    []string      `z:"tags" validate:"max=2"`
+	Timeout time.Duration `z:"timeout" validate:"min=1s,max=1m"`
+	Mode    string        `z:"mode" validate:"oneof=dev prod"`
+	Code    string        `z:"code" validate:"required,regexp=^[a-z]{2,3}$"`
+	Every   string        `z:"every" validate:"duration"`
+	Nested  struct {
+		Host string `z:"host" validate:"required"`
+	} `z:"nested"`
+	Hosts []struct {
+		Addr string `z:"addr" validate:"required"`
+	} `z:"hosts"`
+}
+
+func validRulesConf() testRulesConf {
+	c := testRulesConf{
+		Name:    "app",
+		Port:    80,
+		Timeout: 10 * time.Second,
+		Mode:    "dev",
+		Code:    "ab",
+		Every:   "1m30s",
+	}
+	c.Nested.Host = "localhost"
+	return c
+}
+
+func TestValidateConf(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		modify func(c *testRulesConf)
+		want   ValidationErrors
+	}{
+		{name: "valid", modify: func(c *testRulesConf) {}},
+		{
+			name:   "required",
+			modify: func(c *testRulesConf) { c.Name = "" },
+			want:   ValidationErrors{{Key: "app.name", Rule: "required", Message: "is required"}},
+		},
+		{
+			name:   "min",
+			modify: func(c *testRulesConf) { c.Port = 0 },
+			want:   ValidationErrors{{Key: "app.port", Rule: "min", Message: "must be at least 1"}},
+		},
+		{
+			name:   "max",
+			modify: func(c *testRulesConf) { c.Port = 70000 },
+			want:   ValidationErrors{{Key: "app.port", Rule: "max", Message: "must be at most 65535"}},
+		},
+		{
+			name:   "max length",
+			modify: func(c *testRulesConf) { c.Tags = []string{"a", "b", "c"} },
+			want:   ValidationErrors{{Key: "app.tags", Rule: "max", Message: "must be at most 2"}},
+		},
+		{
+			name:   "min duration",
+			modify: func(c *testRulesConf) { c.Timeout = time.Millisecond },
+			want:   ValidationErrors{{Key: "app.timeout", Rule: "min", Message: "must be at least 1s"}},
+		},
+		{
+			name:   "max duration",
+			modify: func(c *testRulesConf) { c.Timeout = time.Hour },
+			want:   ValidationErrors{{Key: "app.timeout", Rule: "max", Message: "must be at most 1m"}},
+		},
+		{
+			name:   "oneof",
+			modify: func(c *testRulesConf) { c.Mode = "test" },
+			want:   ValidationErrors{{Key: "app.mode", Rule: "oneof", Message: "must be one of [dev, prod]"}},
+		},
+		{
+			name:   "regexp after another rule",
+			modify: func(c *testRulesConf) { c.Code = "a,b" },
+			want:   ValidationErrors{{Key: "app.code", Rule: "regexp", Message: "must match ^[a-z]{2,3}$"}},
+		},
+		{
+			name:   "duration",
+			modify: func(c *testRulesConf) { c.Every = "5x" },
+			want:   ValidationErrors{{Key: "app.every", Rule: "duration", Message: "must be a duration, e.g. 1m30s"}},
+		},
+		{
+			name: "nested and list keys",
+			modify: func(c *testRulesConf) {
+				c.Nested.Host = ""
+				c.Hosts = make([]struct {
+					Addr string `z:"addr" validate:"required"`
+				}, 2)
+				c.Hosts[0].Addr = "a:80"
+			},
+			want: ValidationErrors{
+				{Key: "app.nested.host", Rule: "required", Message: "is required"},
+				{Key: "app.hosts[1].addr", Rule: "required", Message: "is required"},
+			},
+		},
+		{
+			name: "every violation",
+			modify: func(c *testRulesConf) {
+				c.Name, c.Port, c.Code = "", -1, ""
+			},
+			want: ValidationErrors{
+				{Key: "app.name", Rule: "required", Message: "is required"},
+				{Key: "app.port", Rule: "min", Message: "must be at least 1"},
+				{Key: "app.code", Rule: "required", Message: "is required"},
+				{Key: "app.code", Rule: "regexp", Message: "must match ^[a-z]{2,3}$"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validRulesConf()
+			tt.modify(&c)
+			err := ValidateConf("app", &c)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if errs, _ := err.(ValidationErrors); !reflect.DeepEqual(errs, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateConfInvalidRule(t *testing.T) {
+	v := struct {
+		A int    `validate:"min=x"`
+		B string `validate:"unknown"`
+	}{}
+	want := ValidationErrors{
+		{Key: "A", Rule: "min", Message: "invalid rule min=x"},
+		{Key: "B", Rule: "unknown", Message: "unknown rule unknown"},
+	}
+	if errs, _ := ValidateConf("", v).(ValidationErrors); !reflect.DeepEqual(errs, want) {
+		t.Fatalf("expected %v, got %v", want, errs)
+	}
+}
+
+type (
+	testDBConf struct {
+		Port int `z:"port" validate:"min=1"`
+	}
+	testCacheConf struct {
+		TTL string `z:"ttl" validate:"duration"`
+	}
+)
+
+func (testDBConf) ConfKey() string    { return "db" }
+func (testCacheConf) ConfKey() string { return "cache" }
+
+func TestConfValidateSections(t *testing.T) {
+	testConfFile(t, "[db]\nport = 0\n\n[cache]\nttl = '5x'\n")
+	c := NewConf()(zdi.New())
+	c.sections = []interface{}{testDBConf{Port: 3306}, testCacheConf{TTL: "1m"}}
+	err := c.validate()
+	want := ValidationErrors{
+		{Key: "db.port", Rule: "min", Message: "must be at least 1"},
+		{Key: "cache.ttl", Rule: "duration", Message: "must be a duration, e.g. 1m30s"},
+	}
+	if errs, _ := err.(ValidationErrors); !reflect.DeepEqual(errs, want) {
+		t.Fatalf("expected %v, got %v", want, err)
+	}
+	if err.Error() != "invalid config: db.port: must be at least 1; cache.ttl: must be a duration, e.g. 1m30s" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+}
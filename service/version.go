@@ -0,0 +1,168 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	buildinfo "runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// modulePath is the import path of app_core.
+const modulePath = "github.com/zlsgo/app_core"
+
+// Version is the version of app_core read from the build information of the binary,
+// module manifests can require a range of it. It is empty when the version is unknown,
+// e.g. in a development build of app_core itself or with a pseudo-version of an untagged commit,
+// the ranges are not checked then.
+var Version = buildVersion()
+
+// pseudoVersion matches the versions the go command gives to untagged commits, e.g. v0.0.0-20250421042600-ef858c116f8e.
+var pseudoVersion = regexp.MustCompile(`^v[0-9]+\.(0\.0-|[0-9]+\.[0-9]+-([^+]*\.)?0\.)[0-9]{14}-[A-Za-z0-9]+(\+[0-9A-Za-z-.]+)?$`)
+
+func buildVersion() string {
+	info, ok := buildinfo.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	m := &info.Main
+	if m.Path != modulePath {
+		m = nil
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				m = dep
+				break
+			}
+		}
+	}
+	if m == nil {
+		return ""
+	}
+	if m.Replace != nil && m.Replace.Version != "" {
+		m = m.Replace
+	}
+	if m.Version == "(devel)" || pseudoVersion.MatchString(m.Version) {
+		return ""
+	}
+	return m.Version
+}
+
+// semver is a parsed major.minor.patch[-prerelease] version.
+type semver struct {
+	pre   string
+	parts [3]int
+}
+
+func parseVersion(s string) (v semver, err error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre, s = s[i+1:], s[:i]
+	}
+
+	nums := strings.Split(s, ".")
+	if s == "" || len(nums) > 3 {
+		return v, errors.New("invalid version " + strconv.Quote(s))
+	}
+	for i := range nums {
+		v.parts[i], err = strconv.Atoi(nums[i])
+		if err != nil || v.parts[i] < 0 {
+			return v, errors.New("invalid version " + strconv.Quote(s))
+		}
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1, a prerelease is lower than its release.
+func (v semver) compare(o semver) int {
+	for i := range v.parts {
+		if v.parts[i] != o.parts[i] {
+			if v.parts[i] < o.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	case v.pre < o.pre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// matchVersion reports whether version satisfies the constraint.
+// A constraint is a list of alternatives separated by "||", each one a space separated list
+// of comparisons that must all hold: "=", "!=", ">", ">=", "<", "<=",
+// "^" (same major), "~" (same minor), a bare version means "=" and "*" or empty matches any version.
+func matchVersion(version, constraint string) (bool, error) {
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" || constraint == "*" {
+		return true, nil
+	}
+
+	v, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	for _, alt := range strings.Split(constraint, "||") {
+		ok := true
+		for _, c := range strings.Fields(alt) {
+			m, err := matchComparison(v, c)
+			if err != nil {
+				return false, err
+			}
+			ok = ok && m
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchComparison(v semver, c string) (bool, error) {
+	if c == "*" {
+		return true, nil
+	}
+
+	op := strings.TrimRight(c, "0123456789.-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	if op == c {
+		return false, errors.New("invalid version constraint " + strconv.Quote(c))
+	}
+	o, err := parseVersion(c[len(op):])
+	if err != nil {
+		return false, err
+	}
+
+	n := v.compare(o)
+	switch op {
+	case "", "=", "==":
+		return n == 0, nil
+	case "!=":
+		return n != 0, nil
+	case ">":
+		return n > 0, nil
+	case ">=":
+		return n >= 0, nil
+	case "<":
+		return n < 0, nil
+	case "<=":
+		return n <= 0, nil
+	case "^":
+		return n >= 0 && v.parts[0] == o.parts[0], nil
+	case "~":
+		return n >= 0 && v.parts[0] == o.parts[0] && v.parts[1] == o.parts[1], nil
+	}
+	return false, errors.New("invalid version constraint " + strconv.Quote(c))
+}
@@ -0,0 +1,19 @@
+package service
+
+import "testing"
+
+func TestPseudoVersion(t *testing.T) {
+	for version, pseudo := range map[string]bool{
+		"v0.0.0-20250421042600-ef858c116f8e":          true,
+		"v1.2.4-0.20250421042600-ef858c116f8e":        true,
+		"v1.2.3-beta.1.0.20250421042600-ef858c116f8e": true,
+		"v1.2.4-0.20250421042600-ef858c116f8e+dirty":  true,
+		"v1.2.3":      false,
+		"v1.2.3-beta": false,
+		"(devel)":     false,
+	} {
+		if pseudoVersion.MatchString(version) != pseudo {
+			t.Fatalf("expected pseudo-version %v for %s", pseudo, version)
+		}
+	}
+}
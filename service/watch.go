@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sohaha/zlsgo/zfile"
+	"github.com/sohaha/zlsgo/zlog"
+)
+
+// ConfigDebounce is the quiet period after the last change of the config file before it is reloaded.
+var ConfigDebounce = 200 * time.Millisecond
+
+// confWatcher watches the directory of the config file and its layer files, so saves by rename or create
+// and symlink swaps (e.g. Kubernetes ConfigMaps) are seen like plain writes.
+// Changes are coalesced until the file is quiet for the debounce period,
+// and a change during a reload triggers another reload once it is done.
+type confWatcher struct {
+	watcher  *fsnotify.Watcher
+	timer    *time.Timer
+	layers   map[string]struct{}
+	reload   func()
+	log      *zlog.Logger
+	file     string
+	real     string
+	debounce time.Duration
+	mu       sync.Mutex
+	running  bool
+	pending  bool
+	closed   bool
+}
+
+func newConfWatcher(file string, layers []string, debounce time.Duration, reload func(), log *zlog.Logger) (*confWatcher, error) {
+	if file == "" {
+		return nil, errors.New("no config file to watch")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &confWatcher{
+		watcher:  watcher,
+		reload:   reload,
+		log:      log,
+		file:     filepath.Clean(file),
+		debounce: debounce,
+		layers:   make(map[string]struct{}, len(layers)),
+	}
+	for _, l := range layers {
+		w.layers[filepath.Clean(l)] = struct{}{}
+	}
+	w.real = w.realPath()
+	if err = w.watch(); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	go w.loop()
+	return w, nil
+}
+
+// watch adds the directories of the file and of its symlink target, adding one again is a no-op.
+func (w *confWatcher) watch() error {
+	if err := w.watcher.Add(filepath.Dir(w.file)); err != nil {
+		return err
+	}
+	if w.real != "" && filepath.Dir(w.real) != filepath.Dir(w.file) {
+		_ = w.watcher.Add(filepath.Dir(w.real))
+	}
+	return nil
+}
+
+func (w *confWatcher) realPath() string {
+	real, err := filepath.EvalSymlinks(w.file)
+	if err != nil {
+		return ""
+	}
+	return real
+}
+
+func (w *confWatcher) loop() {
+	for {
+		select {
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.relevant(e) {
+				w.schedule()
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.log.Warn("config watcher: " + err.Error())
+		}
+	}
+}
+
+// relevant reports whether the event changes the config file, one of its layer files
+// or where its symlink points to.
+func (w *confWatcher) relevant(e fsnotify.Event) bool {
+	name := filepath.Clean(e.Name)
+	if _, ok := w.layers[name]; ok || name == w.file {
+		return e.Op != fsnotify.Chmod
+	}
+
+	real := w.realPath()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return real != "" && real != w.real
+}
+
+// schedule (re)starts the debounce timer.
+func (w *confWatcher) schedule() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.debounce, w.fire)
+		return
+	}
+	w.timer.Reset(w.debounce)
+}
+
+// fire reloads the configuration, again as long as changes arrived during the reload.
+func (w *confWatcher) fire() {
+	w.mu.Lock()
+	if w.running {
+		w.pending = true
+		w.mu.Unlock()
+		return
+	}
+	w.running = true
+	w.mu.Unlock()
+
+	for {
+		real := w.realPath()
+		w.mu.Lock()
+		w.real = real
+		w.mu.Unlock()
+
+		// The file is missing in the middle of some atomic saves, its creation triggers another reload.
+		if zfile.FileExist(w.file) {
+			_ = w.watch()
+			w.reload()
+		}
+
+		w.mu.Lock()
+		if !w.pending || w.closed {
+			w.running, w.pending = false, false
+			w.mu.Unlock()
+			return
+		}
+		w.pending = false
+		w.mu.Unlock()
+	}
+}
+
+func (w *confWatcher) close() error {
+	w.mu.Lock()
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	return w.watcher.Close()
+}
+
+// watchConf reloads the configuration when the config file changes.
+func (app *App) watchConf(web *Web) {
+	cfg := app.Conf.cfg
+	prev := app.Conf.all()
+	reload := func() {
+		var ev ReloadEvent
+		prev, ev = app.reloadConf(prev)
+		app.logReload(ev)
+		app.publish(ev)
+		if ev.Status == ReloadCommitted {
+			app.toggleModules(web)
+		}
+	}
+
+	file := cfg.Core.ConfigFileUsed()
+	if file == "" {
+		file = cfg.Path()
+	}
+
+	layers := make([]string, 0, len(app.Conf.layers))
+	for _, l := range app.Conf.layers {
+		layers = append(layers, l.file)
+	}
+
+	w, err := newConfWatcher(file, layers, ConfigDebounce, reload, app.Log)
+	if err != nil {
+		app.Log.Warn("config hot reload is unavailable: " + err.Error())
+		return
+	}
+
+	if app.Conf.watcher != nil {
+		_ = app.Conf.watcher.close()
+	}
+	app.Conf.watcher = w
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sohaha/zlsgo/zlog"
+)
+
+// testWatcher watches the file with a short debounce, every reload sends the content of the file.
+func testWatcher(t *testing.T, file string, reload func(content string)) {
+	t.Helper()
+	debounce := ConfigDebounce
+	ConfigDebounce = 20 * time.Millisecond
+	t.Cleanup(func() { ConfigDebounce = debounce })
+
+	log := zlog.New()
+	log.Discard()
+	w, err := newConfWatcher(file, nil, ConfigDebounce, func() {
+		content, _ := os.ReadFile(file)
+		reload(string(content))
+	}, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.close() })
+}
+
+func waitReload(t *testing.T, reloads <-chan string, want string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-reloads:
+			if got == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("expected a reload with %q", want)
+		}
+	}
+}
+
+func TestConfWatcherRenameSave(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "conf.toml")
+	writeConf(t, file, "v1")
+
+	reloads := make(chan string, 10)
+	testWatcher(t, file, func(content string) { reloads <- content })
+
+	tmp := filepath.Join(dir, ".conf.toml.swp")
+	writeConf(t, tmp, "v2")
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, reloads, "v2")
+
+	tmp = filepath.Join(dir, ".conf.toml.swp")
+	writeConf(t, tmp, "v3")
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, reloads, "v3")
+}
+
+func TestConfWatcherSymlinkSwap(t *testing.T) {
+	// The layout of a mounted Kubernetes ConfigMap.
+	dir := t.TempDir()
+	for _, v := range []string{"v1", "v2"} {
+		if err := os.Mkdir(filepath.Join(dir, v), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeConf(t, filepath.Join(dir, v, "conf.toml"), v)
+	}
+	data := filepath.Join(dir, "..data")
+	file := filepath.Join(dir, "conf.toml")
+	if err := os.Symlink("v1", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "conf.toml"), file); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan string, 10)
+	testWatcher(t, file, func(content string) { reloads <- content })
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink("v2", tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, data); err != nil {
+		t.Fatal(err)
+	}
+	waitReload(t, reloads, "v2")
+}
+
+func TestConfWatcherReloadsAfterCoalescedChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "conf.toml")
+	writeConf(t, file, "v1")
+
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	reloads := make(chan string, 10)
+	testWatcher(t, file, func(content string) {
+		mu.Lock()
+		seen = append(seen, content)
+		first := len(seen) == 1
+		mu.Unlock()
+		if first {
+			close(started)
+			<-release
+		}
+		reloads <- content
+	})
+
+	writeConf(t, file, "v2")
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a reload")
+	}
+
+	// Both changes arrive while the first reload is running.
+	writeConf(t, file, "v3")
+	time.Sleep(5 * ConfigDebounce)
+	writeConf(t, file, "v4")
+	time.Sleep(5 * ConfigDebounce)
+	close(release)
+
+	waitReload(t, reloads, "v4")
+	time.Sleep(5 * ConfigDebounce)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 2 {
+		t.Fatalf("expected the changes during the reload to be coalesced into one reload, got %v", seen)
+	}
+}
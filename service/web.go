@@ -92,6 +92,8 @@ func NewWeb() func(app *App, middlewares []znet.Handler, plugin []Module) *Web {
 			r.Use(middleware)
 		}
 
+		registerStatusRoutes(r, app)
+
 		r.Injector().(zdi.Injector).SetParent(app.DI.(zdi.Injector))
 
 		return &Web{
@@ -112,6 +114,7 @@ func RunWeb(app *App) {
 	}
 
 	common.Fatal(initRouter(app, r, *controllers))
+	app.serve(r)
 
 	var ctx context.Context
 	if err := app.DI.Resolve(&ctx); err == nil {
@@ -120,16 +123,7 @@ func RunWeb(app *App) {
 		znet.Run()
 	}
 
-	var ps []Module
-	if err := app.DI.Resolve(&ps); err == nil {
-		for _, p := range ps {
-			of := zreflect.ValueOf(p)
-			stop := of.MethodByName("Stop")
-			if stop.IsValid() {
-				_, _ = app.DI.Invoke(stop.Interface())
-			}
-		}
-	}
+	common.Fatal(StopModules(app))
 }
 
 func getWeb(app *App) (web *Web, controllers *[]Controller) {
@@ -141,8 +135,8 @@ func getWeb(app *App) (web *Web, controllers *[]Controller) {
 		var ps []Module
 		_ = app.DI.Resolve(&ps)
 
-		var m []znet.Handler
-		_ = app.DI.Resolve(&m)
+		m := ResolveAll[znet.Handler](app.DI)
+		_ = app.registry().takeMiddleware()
 
 		web = NewWeb()(app, m, ps)
 		_ = app.DI.(zdi.Injector).Maps(web, web.Engine)
@@ -155,9 +149,10 @@ func getWeb(app *App) (web *Web, controllers *[]Controller) {
 	return
 }
 
-// initRouter initializes the router for the application
-func initRouter(app *App, _ *Web, controllers []Controller) (err error) {
-	err = app.DI.InvokeWithErrorOnly(func(r *Web) error {
+// initRouter initializes the router for the application, the controllers are bound on web
+// or on the Web of the injector when it is nil.
+func initRouter(app *App, web *Web, controllers []Controller, middleware ...znet.Handler) (err error) {
+	bind := func(r *Web) error {
 		for i := range controllers {
 			c := controllers[i]
 			valueOf := zreflect.ValueOf(c)
@@ -172,10 +167,12 @@ func initRouter(app *App, _ *Web, controllers []Controller) (err error) {
 
 			err = zerror.TryCatch(func() (err error) {
 				name := getWebRouterName(value, controller)
-				if name == "" {
-					err = r.BindStruct(name, c)
+				// The middleware of module controllers must stay on a copy of the engine,
+				// the root engine would apply it to every route registered afterwards.
+				if name == "" && len(middleware) == 0 {
+					err = r.BindStruct(name, c, middleware...)
 				} else {
-					err = r.Group("/").BindStruct(name, c)
+					err = r.Group("/").BindStruct(name, c, middleware...)
 				}
 				return
 			})
@@ -184,9 +181,12 @@ func initRouter(app *App, _ *Web, controllers []Controller) (err error) {
 			}
 		}
 		return nil
-	})
+	}
 
-	return
+	if web != nil {
+		return bind(web)
+	}
+	return app.DI.InvokeWithErrorOnly(bind)
 }
 
 func getWebRouterName(value reflect.Value, controller string) string {